@@ -0,0 +1,161 @@
+package msgpack
+import (
+    "strings"
+    "math"
+    "fmt"
+    "io"
+)
+
+// Bytes shown per annotated line before the rest is elided
+const annotateBytes = 8
+
+// Function returns the spec name of a format
+func formatName(k Kind) string {
+    switch k {
+        case FixInt:
+            return "negative fixint"
+        case FixUint:
+            return "positive fixint"
+    }
+
+    return strings.ToLower(k.String())
+}
+
+// Function describes the value of an object from its control byte
+// and payload, ext payloads starting with their type byte
+func describeValue(k Kind, cbyte byte, payload []byte, children int) string {
+    //Big endian payload for numbers
+    var bits uint64
+    if len(payload) <= 8 {
+        for _, b := range payload {
+            bits = bits << 8 | uint64(b)
+        }
+    }
+
+    //nil, true and false are described by their name
+    switch k {
+        case FixUint:
+            return fmt.Sprint(cbyte)
+        case FixInt:
+            return fmt.Sprint(int8(cbyte))
+        case Uint8, Uint16, Uint32, Uint64:
+            return fmt.Sprint(bits)
+        case Int8, Int16, Int32, Int64:
+            shift := 64 - 8*uint(len(payload))
+            return fmt.Sprint(int64(bits << shift) >> shift)
+        case Float32:
+            return fmt.Sprint(math.Float32frombits(uint32(bits)))
+        case Float64:
+            return fmt.Sprint(math.Float64frombits(bits))
+    }
+
+    switch k.Type() {
+        case StringType:
+            if len(payload) > 32 {
+                return fmt.Sprintf("len=%d %q...", len(payload), payload[:32])
+            }
+
+            return fmt.Sprintf("len=%d %q", len(payload), payload)
+        case BinType:
+            return fmt.Sprintf("len=%d", len(payload))
+        case ExtType:
+            return fmt.Sprintf("type=%d len=%d", int8(payload[0]), len(payload)-1)
+        case ArrayType:
+            return fmt.Sprintf("len=%d", children)
+        case MapType:
+            return fmt.Sprintf("len=%d", children/2)
+    }
+
+    return ""
+}
+
+// Function writes one annotated line: offset, raw bytes, then the
+// description indented by depth
+func annotateLine(w io.Writer, off int64, raw []byte, depth int, desc string) error {
+    hex := strings.Builder{}
+    for i, b := range raw {
+        if i == annotateBytes {
+            hex.WriteString("..")
+            break
+        }
+
+        fmt.Fprintf(&hex, "%02x ", b)
+    }
+
+    _, err := fmt.Fprintf(w, "%08x  %-26s %s%s\n", off, hex.String(), strings.Repeat("  ", depth), desc)
+    return err
+}
+
+// Function writes an annotated hex dump of the objects in data:
+// the offset, raw bytes, format and value of each, indented by
+// nesting depth. Malformed data is dumped up to the object that
+// goes wrong, followed by a line marking the offending offset,
+// and the error is returned.
+func Annotate(w io.Writer, data []byte) error {
+    d := newBytesDecoder(data)
+    var open []int  // Objects left in each open array and map
+    for d.r < d.w {
+        depth := len(open)
+        start := d.off
+        cbyte := data[start]
+        children, l, err := d.readHeader()
+
+        //Header runs past the end of data or is invalid
+        errOff := int64(len(data))
+        if serr, ok := err.(*SyntaxError); ok {
+            errOff = serr.Offset
+        }
+
+        if err != nil {
+            return annotateError(w, data[start:], start, errOff, depth, "?", err)
+        } else if d.w-d.r < l {
+            desc := fmt.Sprintf("0x%02x %s", cbyte, formatName(d.k))
+            err = fmt.Errorf("msgpack: %s needs %d payload bytes, %d left", formatName(d.k), l, d.w-d.r)
+            return annotateError(w, data[start:], start, errOff, depth, desc, err)
+        }
+
+        payload := data[d.off:d.off+int64(l)]
+        d.skipBytes(l)
+
+        desc := fmt.Sprintf("0x%02x %s %s", cbyte, formatName(d.k), describeValue(d.k, cbyte, payload, children))
+        if err := annotateLine(w, start, data[start:d.off], depth, strings.TrimSpace(desc)); err != nil {
+            return err
+        }
+
+        //Count this object against its container, then open its own
+        if len(open) > 0 {
+            open[len(open)-1]--
+        }
+
+        if children > 0 {
+            open = append(open, children)
+        }
+
+        for len(open) > 0 && open[len(open)-1] == 0 {
+            open = open[:len(open)-1]
+        }
+    }
+
+    if len(open) > 0 {
+        err := fmt.Errorf("msgpack: %d objects missing from enclosing container", open[len(open)-1])
+        return annotateError(w, nil, d.off, d.off, len(open), "", err)
+    }
+
+    return nil
+}
+
+// Function writes the bytes of the object that goes wrong and a
+// line marking where
+func annotateError(w io.Writer, raw []byte, start int64, errOff int64, depth int, desc string, err error) error {
+    if len(raw) > 0 {
+        if werr := annotateLine(w, start, raw, depth, desc); werr != nil {
+            return werr
+        }
+    }
+
+    if _, werr := fmt.Fprintf(w, "%08x  %-26s %s^^ %v\n", errOff, "", strings.Repeat("  ", depth), err); werr != nil {
+        return werr
+    }
+
+    return err
+}
@@ -0,0 +1,375 @@
+// Command msgpack inspects and converts msgpack data.
+//
+//  msgpack dump [file...]        pretty-print values
+//  msgpack to-json [file...]     convert to JSON, one line per value
+//  msgpack from-json [file...]   convert JSON values to msgpack
+//  msgpack validate [file...]    check files are sequences of well-formed values
+//  msgpack count [file...]       count top level values
+//  msgpack diff [-strict] a b    compare the values of two files
+//
+// Files default to stdin, as does "-".
+package main
+import (
+    "github.com/alzerid/msgpack"
+    "strconv"
+    "strings"
+    "errors"
+    "bufio"
+    "flag"
+    "fmt"
+    "os"
+    "io"
+)
+
+const usageText = `usage: msgpack <command> [flags] [file...]
+  msgpack dump [file...]
+  msgpack to-json [-hex] [-strict-keys] [-nonfinite error|null|string] [file...]
+  msgpack from-json [-large-strings] [file...]
+  msgpack validate [file...]
+  msgpack count [file...]
+  msgpack diff [-strict] a b
+`
+
+// Returned by commands for bad arguments, main prints the usage
+var errUsage = errors.New("usage")
+
+// Returned by diff when the files differ, main exits with status 1
+var errDiffer = errors.New("files differ")
+
+// Commands read files named in args, or stdin, and write to stdout
+var commands = map[string]func(args []string, stdin io.Reader, stdout io.Writer) error{
+    "dump": dump,
+    "to-json": toJSON,
+    "from-json": fromJSON,
+    "validate": validate,
+    "count": count,
+    "diff": diff,
+}
+
+func usage() {
+    fmt.Fprint(os.Stderr, usageText)
+    os.Exit(2)
+}
+
+func main() {
+    if len(os.Args) < 2 {
+        usage()
+    }
+
+    cmd, ok := commands[os.Args[1]]
+    if !ok {
+        usage()
+    }
+
+    err := cmd(os.Args[2:], os.Stdin, os.Stdout)
+    switch {
+        case errors.Is(err, errUsage):
+            usage()
+
+        //Like diff(1), differences are reported by the exit status
+        case errors.Is(err, errDiffer):
+            os.Exit(1)
+
+        case err != nil:
+            fmt.Fprintln(os.Stderr, "msgpack:", err)
+            os.Exit(1)
+    }
+}
+
+// Function parses the flags of a command and returns its files
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+    fs.Usage = func() {}
+    if err := fs.Parse(args); err != nil {
+        return nil, errUsage
+    } else if fs.NArg() == 0 {
+        return []string{ "-" }, nil
+    }
+
+    return fs.Args(), nil
+}
+
+// Function calls fn with each file opened in turn, "-" being stdin
+func eachFile(files []string, stdin io.Reader, fn func(name string, r io.Reader) error) error {
+    for _, name := range files {
+        if name == "-" {
+            if err := fn("<stdin>", stdin); err != nil {
+                return err
+            }
+
+            continue
+        }
+
+        f, err := os.Open(name)
+        if err != nil {
+            return err
+        }
+
+        err = fn(name, f)
+        f.Close()
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+/************************/
+/** Start Commands     **/
+/************************/
+
+func dump(args []string, stdin io.Reader, stdout io.Writer) error {
+    files, err := parseFlags(flag.NewFlagSet("dump", flag.ContinueOnError), args)
+    if err != nil {
+        return err
+    }
+
+    out := bufio.NewWriter(stdout)
+    defer out.Flush()
+
+    return eachFile(files, stdin, func(name string, r io.Reader) error {
+        dec := msgpack.NewDecoder(r)
+        for dec.More() {
+            var v msgpack.Value
+            if err := dec.Decode(&v); err != nil {
+                return fmt.Errorf("%s: %w", name, err)
+            }
+
+            printValue(out, v, 0)
+            out.WriteByte('\n')
+        }
+
+        //More hides read errors until the next call
+        if _, err := dec.PeekKind(); err != nil && err != io.EOF {
+            return fmt.Errorf("%s: %w", name, err)
+        }
+
+        return nil
+    })
+}
+
+func toJSON(args []string, stdin io.Reader, stdout io.Writer) error {
+    fs := flag.NewFlagSet("to-json", flag.ContinueOnError)
+    hex := fs.Bool("hex", false, "write bin and ext data as hex instead of base64")
+    strict := fs.Bool("strict-keys", false, "fail on map keys that are not strings")
+    nonFinite := fs.String("nonfinite", "error", "handling of NaN and infinity: error, null or string")
+    files, err := parseFlags(fs, args)
+    if err != nil {
+        return err
+    }
+
+    opts := msgpack.JSONOptions{ StrictKeys: *strict }
+    if *hex {
+        opts.Bin = msgpack.BinHex
+    }
+
+    switch *nonFinite {
+        case "error":
+            opts.NonFinite = msgpack.NonFiniteError
+        case "null":
+            opts.NonFinite = msgpack.NonFiniteNull
+        case "string":
+            opts.NonFinite = msgpack.NonFiniteString
+        default:
+            return errUsage
+    }
+
+    return eachFile(files, stdin, func(name string, r io.Reader) error {
+        if err := opts.ToJSON(stdout, r); err != nil {
+            return fmt.Errorf("%s: %w", name, err)
+        }
+
+        return nil
+    })
+}
+
+func fromJSON(args []string, stdin io.Reader, stdout io.Writer) error {
+    fs := flag.NewFlagSet("from-json", flag.ContinueOnError)
+    large := fs.Bool("large-strings", false, "keep numbers that do not fit 64 bits as strings")
+    files, err := parseFlags(fs, args)
+    if err != nil {
+        return err
+    }
+
+    opts := msgpack.JSONOptions{ LargeNumbersAsStrings: *large }
+    return eachFile(files, stdin, func(name string, r io.Reader) error {
+        if err := opts.FromJSON(stdout, r); err != nil {
+            return fmt.Errorf("%s: %w", name, err)
+        }
+
+        return nil
+    })
+}
+
+// Function returns the number of values in r, failing on the
+// first malformed one
+func countValues(r io.Reader) (int, error) {
+    dec := msgpack.NewDecoder(r)
+    for n := 0; ; n++ {
+        if err := dec.Skip(); err == io.EOF {
+            return n, nil
+        } else if err != nil {
+            return n, fmt.Errorf("value %d at offset %d: %w", n, dec.InputOffset(), err)
+        }
+    }
+}
+
+func validate(args []string, stdin io.Reader, stdout io.Writer) error {
+    files, err := parseFlags(flag.NewFlagSet("validate", flag.ContinueOnError), args)
+    if err != nil {
+        return err
+    }
+
+    failed := 0
+    err = eachFile(files, stdin, func(name string, r io.Reader) error {
+        n, err := countValues(r)
+        if err != nil {
+            fmt.Fprintf(stdout, "%s: %v\n", name, err)
+            failed++
+        } else {
+            fmt.Fprintf(stdout, "%s: ok, %d values\n", name, n)
+        }
+
+        return nil
+    })
+
+    if err == nil && failed > 0 {
+        err = fmt.Errorf("%d of %d files invalid", failed, len(files))
+    }
+
+    return err
+}
+
+func count(args []string, stdin io.Reader, stdout io.Writer) error {
+    files, err := parseFlags(flag.NewFlagSet("count", flag.ContinueOnError), args)
+    if err != nil {
+        return err
+    }
+
+    return eachFile(files, stdin, func(name string, r io.Reader) error {
+        n, err := countValues(r)
+        if err != nil {
+            return fmt.Errorf("%s: %w", name, err)
+        }
+
+        if len(files) > 1 {
+            fmt.Fprintf(stdout, "%s: %d\n", name, n)
+        } else {
+            fmt.Fprintln(stdout, n)
+        }
+
+        return nil
+    })
+}
+
+func diff(args []string, stdin io.Reader, stdout io.Writer) error {
+    fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+    strict := fs.Bool("strict", false, "compare integer widths and map key order")
+    files, err := parseFlags(fs, args)
+    if err != nil {
+        return err
+    } else if len(files) != 2 {
+        return errUsage
+    }
+
+    //Files holding several values compare as arrays of them
+    var docs [2]msgpack.Value
+    for i, name := range files {
+        err := eachFile([]string{ name }, stdin, func(name string, r io.Reader) error {
+            var vals []msgpack.Value
+            dec := msgpack.NewDecoder(r)
+            for {
+                var v msgpack.Value
+                if err := dec.Decode(&v); err == io.EOF {
+                    break
+                } else if err != nil {
+                    return fmt.Errorf("%s: %w", name, err)
+                }
+
+                vals = append(vals, v)
+            }
+
+            docs[i] = msgpack.NewArray(vals...)
+            if len(vals) == 1 {
+                docs[i] = vals[0]
+            }
+
+            return nil
+        })
+
+        if err != nil {
+            return err
+        }
+    }
+
+    diffs := msgpack.DiffOptions{ Strict: *strict }.DiffValues(docs[0], docs[1])
+    for _, d := range diffs {
+        fmt.Fprintln(stdout, d)
+    }
+
+    if len(diffs) > 0 {
+        return errDiffer
+    }
+
+    return nil
+}
+
+/************************/
+/** End Commands       **/
+/************************/
+
+// Function writes v indented by depth, one element per line
+func printValue(out *bufio.Writer, v msgpack.Value, depth int) {
+    indent := strings.Repeat("  ", depth)
+    switch v.Type() {
+        case msgpack.ArrayType:
+            if v.Len() == 0 {
+                out.WriteString("[]")
+                return
+            }
+
+            out.WriteString("[\n")
+            for i, e := range v.Array() {
+                out.WriteString(indent + "  ")
+                printValue(out, e, depth+1)
+                if i < v.Len()-1 {
+                    out.WriteByte(',')
+                }
+
+                out.WriteByte('\n')
+            }
+
+            out.WriteString(indent + "]")
+
+        case msgpack.MapType:
+            if v.Len() == 0 {
+                out.WriteString("{}")
+                return
+            }
+
+            out.WriteString("{\n")
+            for i, item := range v.Items() {
+                out.WriteString(indent + "  ")
+                printValue(out, item.Key, depth+1)
+                out.WriteString(": ")
+                printValue(out, item.Value, depth+1)
+                if i < v.Len()-1 {
+                    out.WriteByte(',')
+                }
+
+                out.WriteByte('\n')
+            }
+
+            out.WriteString(indent + "}")
+
+        case msgpack.StringType:
+            out.WriteString(strconv.Quote(v.String()))
+
+        //Numbers show the format they were encoded with
+        case msgpack.IntType, msgpack.UintType, msgpack.FloatType:
+            fmt.Fprintf(out, "%v (%v)", v.Interface(), v.Kind())
+
+        default:
+            out.WriteString(v.String())
+    }
+}
@@ -0,0 +1,103 @@
+package main
+import (
+    "github.com/alzerid/msgpack"
+    "path/filepath"
+    "testing"
+    "strings"
+    "errors"
+    "bufio"
+    "bytes"
+    "fmt"
+    "os"
+)
+
+// Function encodes values one after another
+func encodeAll(vals ...interface{}) []byte {
+    buf := bytes.Buffer{}
+    enc := msgpack.NewEncoder(&buf)
+    for _, v := range vals {
+        if err := enc.Encode(v); err != nil {
+            panic(err)
+        }
+    }
+
+    return buf.Bytes()
+}
+
+// Test counting values and stopping at malformed ones
+func TestCountValues(t *testing.T) {
+    for i, tc := range []struct{ data []byte; n int; fails bool }{
+        { nil, 0, false },
+        { encodeAll(1, "a", []int{ 1, 2 }), 3, false },
+        { append(encodeAll(1, 2), 0xc1), 2, true },
+        { append(encodeAll(1), 0x92, 0x01), 1, true },
+    }{
+        n, err := countValues(bytes.NewReader(tc.data))
+        if n != tc.n || (err != nil) != tc.fails {
+            panic(fmt.Sprintf("Count mismatch for case %d! %d %v", i, n, err))
+        }
+        t.Log(err)
+    }
+}
+
+// Test printing values indented with their number formats
+func TestPrintValue(t *testing.T) {
+    for i, tc := range []struct{ v msgpack.Value; want string }{
+        { msgpack.NewInt(-1), "-1 (FixInt)" },
+        { msgpack.NewUint(300), "300 (Uint16)" },
+        { msgpack.NewString("a\"b"), `"a\"b"` },
+        { msgpack.NewNil(), "<nil>" },
+        { msgpack.NewArray(), "[]" },
+        { msgpack.NewMap(), "{}" },
+        { msgpack.NewArray(msgpack.NewBool(true), msgpack.NewArray(msgpack.NewFloat64(1.5))), "[\n  true,\n  [\n    1.5 (Float64)\n  ]\n]" },
+        { msgpack.NewMap(msgpack.MapItem{ Key: msgpack.NewString("k"), Value: msgpack.NewBin([]byte{ 1 }) }), "{\n  \"k\": bin(01)\n}" },
+    }{
+        sb := strings.Builder{}
+        out := bufio.NewWriter(&sb)
+        printValue(out, tc.v, 0)
+        out.Flush()
+        if sb.String() != tc.want {
+            panic(fmt.Sprintf("Print mismatch for case %d!\n%s\n%s", i, sb.String(), tc.want))
+        }
+    }
+}
+
+// Test the commands on stdin and files
+func TestCommands(t *testing.T) {
+    dir := t.TempDir()
+    file := func(name string, data []byte) string {
+        path := filepath.Join(dir, name)
+        if err := os.WriteFile(path, data, 0644); err != nil {
+            panic(err)
+        }
+
+        return path
+    }
+
+    a := file("a", encodeAll(map[string]int{ "x": 1 }))
+    b := file("b", encodeAll(map[string]int{ "x": 2 }))
+    bad := file("bad", []byte{ 0x92, 0x01 })
+
+    for _, tc := range []struct{ args []string; stdin []byte; want string; err error }{
+        { []string{ "dump" }, encodeAll([]interface{}{ 1, "s" }), "[\n  1 (FixUint),\n  \"s\"\n]\n", nil },
+        { []string{ "to-json" }, encodeAll(map[string][]byte{ "b": { 0xab } }, nil), "{\"b\":\"qw==\"}\nnull\n", nil },
+        { []string{ "to-json", "-hex" }, encodeAll([]byte{ 0xab }), "\"ab\"\n", nil },
+        { []string{ "to-json", "-nonfinite", "maybe" }, nil, "", errUsage },
+        { []string{ "from-json" }, []byte(`[1, "a"]`), string(encodeAll([]interface{}{ 1, "a" })), nil },
+        { []string{ "count" }, encodeAll(1, 2, 3), "3\n", nil },
+        { []string{ "count", a, a }, nil, a + ": 1\n" + a + ": 1\n", nil },
+        { []string{ "validate", a, bad }, nil, a + ": ok, 1 values\n" + bad + ": value 0 at offset 2: unexpected EOF\n", errors.New("1 of 2 files invalid") },
+        { []string{ "diff", a, a }, nil, "", nil },
+        { []string{ "diff", a, b }, nil, "~ x: 1 -> 2\n", errDiffer },
+        { []string{ "diff", a }, nil, "", errUsage },
+        { []string{ "dump", "-nope" }, nil, "", errUsage },
+    }{
+        out := bytes.Buffer{}
+        err := commands[tc.args[0]](tc.args[1:], bytes.NewReader(tc.stdin), &out)
+        if out.String() != tc.want {
+            panic(fmt.Sprintf("%q output mismatch!\n%q\n%q", tc.args, out.String(), tc.want))
+        } else if (err == nil) != (tc.err == nil) || (err != nil && err.Error() != tc.err.Error()) {
+            panic(fmt.Sprintf("%q error mismatch! %v != %v", tc.args, err, tc.err))
+        }
+    }
+}
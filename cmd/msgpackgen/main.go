@@ -0,0 +1,669 @@
+// Command msgpackgen generates MarshalMsg, UnmarshalMsg and Msgsize
+// methods for struct types, so encoding and decoding them needs no
+// reflection. Fields are keyed by the same msgpack tags Encode and
+// Decode use.
+//
+//  msgpackgen [-type T1,T2] [-o out.go] file.go
+//
+// Types default to every struct type declared in the file and the
+// output to file_msgpack.go. From a go:generate directive the file
+// defaults to $GOFILE:
+//
+//  //go:generate msgpackgen -type Order
+//
+// Fields of types the generator does not know, such as types from
+// other packages, are encoded and decoded with reflection.
+package main
+import (
+    "github.com/alzerid/msgpack"
+    "path/filepath"
+    "go/parser"
+    "go/format"
+    "go/token"
+    "go/types"
+    "go/ast"
+    "strconv"
+    "strings"
+    "reflect"
+    "bytes"
+    "flag"
+    "sort"
+    "fmt"
+    "os"
+)
+
+const usageText = `usage: msgpackgen [-type T1,T2] [-o out.go] file.go
+`
+
+func usage() {
+    fmt.Fprint(os.Stderr, usageText)
+    os.Exit(2)
+}
+
+func main() {
+    typeNames := flag.String("type", "", "comma separated struct types, default all")
+    output := flag.String("o", "", "output file, default <file>_msgpack.go")
+    flag.Usage = usage
+    flag.Parse()
+
+    file := os.Getenv("GOFILE")
+    if flag.NArg() == 1 {
+        file = flag.Arg(0)
+    } else if flag.NArg() > 1 || file == "" {
+        usage()
+    }
+
+    if *output == "" {
+        *output = strings.TrimSuffix(file, ".go") + "_msgpack.go"
+    }
+
+    var names []string
+    if *typeNames != "" {
+        names = strings.Split(*typeNames, ",")
+    }
+
+    src, err := generate(file, *output, names)
+    if err == nil {
+        err = os.WriteFile(*output, src, 0644)
+    }
+
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "msgpackgen:", err)
+        os.Exit(1)
+    }
+}
+
+// How a type is encoded
+type fieldKind int
+
+const (
+    kindReflect fieldKind = iota    // Through reflection
+    kindBool
+    kindString
+    kindBytes
+    kindInt
+    kindUint
+    kindFloat32
+    kindFloat64
+    kindSlice
+    kindMap
+    kindPtr
+    kindGenerated                   // A struct getting methods
+)
+
+// Predeclared types with their kind and integer size
+var basicKinds = map[string]struct{ kind fieldKind; bits int }{
+    "bool": { kindBool, 0 },
+    "string": { kindString, 0 },
+    "int": { kindInt, 0 }, "int8": { kindInt, 8 }, "int16": { kindInt, 16 }, "int32": { kindInt, 32 }, "int64": { kindInt, 64 },
+    "uint": { kindUint, 0 }, "uint8": { kindUint, 8 }, "uint16": { kindUint, 16 }, "uint32": { kindUint, 32 }, "uint64": { kindUint, 64 },
+    "byte": { kindUint, 8 }, "rune": { kindInt, 32 },
+    "float32": { kindFloat32, 0 }, "float64": { kindFloat64, 0 },
+}
+
+// An encoded struct field
+type field struct {
+    name string   // Go name
+    key string    // Map key
+    typ ast.Expr
+}
+
+type generator struct {
+    out bytes.Buffer
+    types map[string]ast.Expr       // Type declarations of the package
+    generated map[string]bool       // Types with generated methods
+    imports map[string]string       // Import paths of the file by name
+    used map[string]bool            // Imports the output refers to
+    n int                           // Counter for temporary names
+    path []string                   // Keys and indexes leading to the value being decoded
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+    fmt.Fprintf(&g.out, format, args...)
+}
+
+// Method returns a fresh temporary name
+func (g *generator) temp(prefix string) string {
+    g.n++
+    return fmt.Sprintf("z%s%d", prefix, g.n)
+}
+
+// Function generates the methods of the named struct types of file,
+// or all of them, returning the formatted source of output
+func generate(file string, output string, names []string) ([]byte, error) {
+    fset := token.NewFileSet()
+    f, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+    if err != nil {
+        return nil, err
+    }
+
+    g := &generator{ types: map[string]ast.Expr{}, generated: map[string]bool{}, imports: map[string]string{}, used: map[string]bool{} }
+
+    //Types of the whole package, skipping a previous output
+    dir := filepath.Dir(file)
+    others, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+    for _, name := range others {
+        if same, _ := sameFile(name, output); same || (strings.HasSuffix(name, "_test.go") && !strings.HasSuffix(file, "_test.go")) {
+            continue
+        }
+
+        pf, err := parser.ParseFile(fset, name, nil, 0)
+        if err != nil || pf.Name.Name != f.Name.Name {
+            continue
+        }
+
+        g.collect(pf)
+    }
+    g.collect(f)
+
+    for _, imp := range f.Imports {
+        path, _ := strconv.Unquote(imp.Path.Value)
+        name := filepath.Base(path)
+        if imp.Name != nil {
+            name = imp.Name.Name
+        }
+
+        g.imports[name] = path
+    }
+
+    //Struct types in declaration order
+    var structs []*ast.TypeSpec
+    want := map[string]bool{}
+    for _, name := range names {
+        want[strings.TrimSpace(name)] = true
+    }
+
+    for _, decl := range f.Decls {
+        gd, ok := decl.(*ast.GenDecl)
+        if !ok || gd.Tok != token.TYPE {
+            continue
+        }
+
+        for _, spec := range gd.Specs {
+            ts := spec.(*ast.TypeSpec)
+            if _, isStruct := ts.Type.(*ast.StructType); isStruct && ts.TypeParams == nil && (len(names) == 0 || want[ts.Name.Name]) {
+                structs = append(structs, ts)
+                g.generated[ts.Name.Name] = true
+            }
+        }
+    }
+
+    for name := range want {
+        if !g.generated[name] {
+            return nil, fmt.Errorf("%s: no struct type %s", file, name)
+        }
+    }
+
+    for _, ts := range structs {
+        fields := g.fields(ts.Type.(*ast.StructType))
+        g.marshalStruct(ts.Name.Name, fields)
+        g.unmarshalStruct(ts.Name.Name, fields)
+        g.sizeStruct(ts.Name.Name, fields)
+    }
+
+    //Header with the imports the methods need
+    var head bytes.Buffer
+    fmt.Fprintf(&head, "// Code generated by msgpackgen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", f.Name.Name)
+    paths := []string{ strconv.Quote("github.com/alzerid/msgpack"), strconv.Quote("io") }
+    for name := range g.used {
+        path := g.imports[name]
+        if filepath.Base(path) == name {
+            paths = append(paths, strconv.Quote(path))
+        } else {
+            paths = append(paths, name + " " + strconv.Quote(path))
+        }
+    }
+
+    sort.Strings(paths)
+    for _, path := range paths {
+        fmt.Fprintf(&head, "\t%s\n", path)
+    }
+    head.WriteString(")\n\n")
+    head.Write(g.out.Bytes())
+
+    src, err := format.Source(head.Bytes())
+    if err != nil {
+        return nil, fmt.Errorf("generated invalid code: %w", err)
+    }
+
+    return src, nil
+}
+
+// Function reports whether two paths name the same file
+func sameFile(a, b string) (bool, error) {
+    fa, err := os.Stat(a)
+    if err != nil {
+        return false, err
+    }
+
+    fb, err := os.Stat(b)
+    if err != nil {
+        return false, err
+    }
+
+    return os.SameFile(fa, fb), nil
+}
+
+// Method records the type declarations of a file and the types
+// that already have generated decoders
+func (g *generator) collect(f *ast.File) {
+    for _, decl := range f.Decls {
+        switch decl := decl.(type) {
+            case *ast.GenDecl:
+                for _, spec := range decl.Specs {
+                    if ts, ok := spec.(*ast.TypeSpec); ok && ts.TypeParams == nil {
+                        g.types[ts.Name.Name] = ts.Type
+                    }
+                }
+
+            case *ast.FuncDecl:
+                if decl.Recv == nil || decl.Name.Name != "UnmarshalMsg" {
+                    continue
+                }
+
+                recv := decl.Recv.List[0].Type
+                if star, ok := recv.(*ast.StarExpr); ok {
+                    recv = star.X
+                }
+
+                if id, ok := recv.(*ast.Ident); ok {
+                    g.generated[id.Name] = true
+                }
+        }
+    }
+}
+
+// Method returns the encoded fields of a struct, keyed the way
+// msgpack.StructFieldKey keys them
+func (g *generator) fields(st *ast.StructType) []field {
+    var fields []field
+    for _, f := range st.Fields.List {
+        var tag reflect.StructTag
+        if f.Tag != nil {
+            t, _ := strconv.Unquote(f.Tag.Value)
+            tag = reflect.StructTag(t)
+        }
+
+        //Embedded fields are named after their type
+        names := f.Names
+        if len(names) == 0 {
+            t := f.Type
+            if star, ok := t.(*ast.StarExpr); ok {
+                t = star.X
+            }
+
+            if sel, ok := t.(*ast.SelectorExpr); ok {
+                t = sel.Sel
+            }
+
+            if id, ok := t.(*ast.Ident); ok {
+                names = []*ast.Ident{ id }
+            }
+        }
+
+        for _, name := range names {
+            sf := reflect.StructField{ Name: name.Name, Tag: tag }
+            if !ast.IsExported(name.Name) {
+                sf.PkgPath = "-"
+            }
+
+            if key, ok := msgpack.StructFieldKey(sf); ok {
+                fields = append(fields, field{ name.Name, key, f.Type })
+            }
+        }
+    }
+
+    return fields
+}
+
+// Method returns how a type is encoded, with the size of integers
+func (g *generator) classify(t ast.Expr) (fieldKind, int) {
+    switch t := unparen(t).(type) {
+        case *ast.Ident:
+            if g.generated[t.Name] {
+                return kindGenerated, 0
+            }
+
+            //Named types of a predeclared type convert to it
+            decl, declared := g.types[t.Name]
+            if !declared {
+                b := basicKinds[t.Name]
+                return b.kind, b.bits
+            } else if id, ok := decl.(*ast.Ident); ok && g.types[id.Name] == nil {
+                b := basicKinds[id.Name]
+                return b.kind, b.bits
+            }
+
+        case *ast.ArrayType:
+            if t.Len != nil {
+                break
+            } else if id, ok := t.Elt.(*ast.Ident); ok && (id.Name == "byte" || id.Name == "uint8") {
+                return kindBytes, 0
+            }
+
+            return kindSlice, 0
+
+        case *ast.MapType:
+            if k, _ := g.classify(t.Key); k == kindString {
+                return kindMap, 0
+            }
+
+        case *ast.StarExpr:
+            return kindPtr, 0
+    }
+
+    return kindReflect, 0
+}
+
+// Method returns the source of a type, recording the imports it uses
+func (g *generator) typeString(t ast.Expr) string {
+    ast.Inspect(t, func(n ast.Node) bool {
+        if sel, ok := n.(*ast.SelectorExpr); ok {
+            if id, ok := sel.X.(*ast.Ident); ok {
+                g.used[id.Name] = true
+            }
+        }
+
+        return true
+    })
+
+    return types.ExprString(t)
+}
+
+// Function strips the parentheses around a type
+func unparen(t ast.Expr) ast.Expr {
+    for {
+        p, ok := t.(*ast.ParenExpr)
+        if !ok {
+            return t
+        }
+
+        t = p.X
+    }
+}
+
+// Function returns the element type of a slice, map or pointer
+func elemOf(t ast.Expr) ast.Expr {
+    switch t := unparen(t).(type) {
+        case *ast.ArrayType:
+            return t.Elt
+        case *ast.MapType:
+            return t.Value
+        case *ast.StarExpr:
+            return t.X
+    }
+
+    return nil
+}
+
+/**************************/
+/** Start Marshal        **/
+/**************************/
+
+func (g *generator) marshalStruct(name string, fields []field) {
+    g.printf("// MarshalMsg appends the msgpack encoding of z to b.\n")
+    g.printf("func (z %s) MarshalMsg(b []byte) (_ []byte, err error) {\n", name)
+    g.printf("b = msgpack.AppendMapHeader(b, %d)\n", len(fields))
+    for _, f := range fields {
+        g.printf("b = msgpack.AppendString(b, %q)\n", f.key)
+        g.marshal(f.typ, "z." + f.name)
+    }
+    g.printf("return b, nil\n}\n\n")
+}
+
+// Method writes the code appending v of type t to b
+func (g *generator) marshal(t ast.Expr, v string) {
+    k, _ := g.classify(t)
+    switch k {
+        case kindBool:
+            g.printf("b = msgpack.AppendBool(b, bool(%s))\n", v)
+        case kindString:
+            g.printf("b = msgpack.AppendString(b, string(%s))\n", v)
+        case kindBytes:
+            g.printf("b = msgpack.AppendBytes(b, []byte(%s))\n", v)
+        case kindInt:
+            g.printf("b = msgpack.AppendInt(b, int64(%s))\n", v)
+        case kindUint:
+            g.printf("b = msgpack.AppendUint(b, uint64(%s))\n", v)
+        case kindFloat32:
+            g.printf("b = msgpack.AppendFloat32(b, float32(%s))\n", v)
+        case kindFloat64:
+            g.printf("b = msgpack.AppendFloat64(b, float64(%s))\n", v)
+
+        case kindSlice:
+            e := g.temp("e")
+            g.printf("b = msgpack.AppendArrayHeader(b, len(%s))\n", v)
+            g.printf("for _, %s := range %s {\n", e, v)
+            g.marshal(elemOf(t), e)
+            g.printf("}\n")
+
+        case kindMap:
+            mk, mv := g.temp("k"), g.temp("v")
+            g.printf("b = msgpack.AppendMapHeader(b, len(%s))\n", v)
+            g.printf("for %s, %s := range %s {\n", mk, mv, v)
+            g.printf("b = msgpack.AppendString(b, string(%s))\n", mk)
+            g.marshal(elemOf(t), mv)
+            g.printf("}\n")
+
+        case kindPtr:
+            g.printf("if %s == nil {\nb = msgpack.AppendNil(b)\n} else {\n", v)
+            g.marshal(elemOf(t), "(*" + v + ")")
+            g.printf("}\n")
+
+        case kindGenerated:
+            g.printf("if b, err = %s.MarshalMsg(b); err != nil {\nreturn b, err\n}\n", v)
+        default:
+            g.printf("if b, err = msgpack.AppendInterface(b, %s); err != nil {\nreturn b, err\n}\n", v)
+    }
+}
+
+/************************/
+/** End Marshal        **/
+/************************/
+
+/**************************/
+/** Start Unmarshal      **/
+/**************************/
+
+func (g *generator) unmarshalStruct(name string, fields []field) {
+    g.printf("// UnmarshalMsg decodes the msgpack value at the start of b into z\n")
+    g.printf("// and returns the bytes after it.\n")
+    g.printf("func (z *%s) UnmarshalMsg(b []byte) (_ []byte, err error) {\n", name)
+    g.printf("if msgpack.IsNil(b) {\n*z = %s{}\nreturn b[1:], nil\n}\n\n", name)
+    g.printf("var n int\nvar key []byte\n")
+    g.printf("if n, b, err = msgpack.ReadMapHeaderBytes(b); err != nil {\nreturn b, err\n}\n\n")
+
+    //Running out of bytes after the header is a truncated value
+    g.printf("defer func() {\nif err == io.EOF {\nerr = io.ErrUnexpectedEOF\n}\n}()\n\n")
+    g.printf("for i := 0; i < n; i++ {\n")
+    g.printf("if key, b, err = msgpack.ReadMapKeyBytes(b); err != nil {\nreturn b, err\n}\n\n")
+    g.printf("switch string(key) {\n")
+
+    //The first of fields sharing a key is decoded
+    seen := map[string]bool{}
+    for _, f := range fields {
+        if seen[f.key] {
+            continue
+        }
+
+        seen[f.key] = true
+        g.printf("case %q:\n", f.key)
+        g.path = []string{ strconv.Quote(f.key) }
+        g.unmarshal(f.typ, "z." + f.name)
+    }
+
+    g.printf("default:\nif b, err = msgpack.SkipBytes(b); err != nil {\nreturn b, err\n}\n")
+    g.printf("}\n}\n\nreturn b, nil\n}\n\n")
+}
+
+// Method returns the statement returning an error decoding v,
+// with the path to v for type errors
+func (g *generator) fail(v string) string {
+    return fmt.Sprintf("return b, msgpack.FieldError(err, &%s, %s)", v, strings.Join(g.path, ", "))
+}
+
+// Method writes the code decoding the start of b into v of type t.
+// nil sets v to its zero value as Decode does.
+func (g *generator) unmarshal(t ast.Expr, v string) {
+    k, bits := g.classify(t)
+    zero := map[fieldKind]string{ kindBool: "false", kindString: `""`, kindInt: "0", kindUint: "0", kindFloat32: "0", kindFloat64: "0", kindSlice: "nil", kindMap: "nil", kindPtr: "nil" }
+    if z, ok := zero[k]; ok {
+        g.printf("if msgpack.IsNil(b) {\n%s = %s\nb = b[1:]\n} else {\n", v, z)
+        defer g.printf("}\n")
+    }
+
+    switch k {
+        case kindBool:
+            g.read(t, v, "bool", "msgpack.ReadBoolBytes(b)")
+        case kindString:
+            g.read(t, v, "string", "msgpack.ReadStringBytes(b)")
+        case kindBytes:
+            g.read(t, v, "[]byte", "msgpack.ReadBytesBytes(b)")
+        case kindInt:
+            g.read(t, v, "int64", fmt.Sprintf("msgpack.ReadIntBytes(b, %d)", bits))
+        case kindUint:
+            g.read(t, v, "uint64", fmt.Sprintf("msgpack.ReadUintBytes(b, %d)", bits))
+        case kindFloat32, kindFloat64:
+            g.read(t, v, "float64", "msgpack.ReadFloat64Bytes(b)")
+
+        case kindSlice:
+            n, i := g.temp("n"), g.temp("i")
+            g.printf("var %s int\n", n)
+            g.printf("if %s, b, err = msgpack.ReadArrayHeaderBytes(b); err != nil {\n%s\n}\n", n, g.fail(v))
+            //Empty arrays decode non-nil like Unmarshal does
+            g.printf("if %s != nil && cap(%s) >= %s {\n%s = %s[:%s]\n} else {\n%s = make(%s, %s)\n}\n", v, v, n, v, v, n, v, g.typeString(t), n)
+            g.printf("for %s := range %s {\n", i, v)
+            g.path = append(g.path, i)
+            g.unmarshal(elemOf(t), v + "[" + i + "]")
+            g.path = g.path[:len(g.path)-1]
+            g.printf("}\n")
+
+        case kindMap:
+            n, i, mk, mv := g.temp("n"), g.temp("i"), g.temp("k"), g.temp("v")
+            g.printf("var %s int\n", n)
+            g.printf("if %s, b, err = msgpack.ReadMapHeaderBytes(b); err != nil {\n%s\n}\n", n, g.fail(v))
+            g.printf("if %s == nil {\n%s = make(%s, %s)\n}\n", v, v, g.typeString(t), n)
+            g.printf("for %s := 0; %s < %s; %s++ {\n", i, i, n, i)
+            key := unparen(t).(*ast.MapType).Key
+            g.printf("var %s %s\nvar %s %s\n", mk, g.typeString(key), mv, g.typeString(elemOf(t)))
+            g.unmarshal(key, mk)
+
+            //Integer keys are converted so they are not taken for indexes
+            if kk, _ := g.classify(key); kk == kindInt {
+                g.path = append(g.path, "int64(" + mk + ")")
+            } else {
+                g.path = append(g.path, mk)
+            }
+
+            g.unmarshal(elemOf(t), mv)
+            g.path = g.path[:len(g.path)-1]
+            g.printf("%s[%s] = %s\n}\n", v, mk, mv)
+
+        case kindPtr:
+            g.printf("if %s == nil {\n%s = new(%s)\n}\n", v, v, g.typeString(elemOf(t)))
+            g.unmarshal(elemOf(t), "(*" + v + ")")
+
+        case kindGenerated:
+            g.printf("if b, err = %s.UnmarshalMsg(b); err != nil {\n%s\n}\n", v, g.fail(v))
+        default:
+            g.printf("if b, err = msgpack.UnmarshalNext(b, &%s); err != nil {\n%s\n}\n", v, g.fail(v))
+    }
+}
+
+// Method writes the code reading a value of type read with call and
+// converting it to t
+func (g *generator) read(t ast.Expr, v string, read string, call string) {
+    tmp := g.temp("t")
+    g.printf("var %s %s\n", tmp, read)
+    g.printf("if %s, b, err = %s; err != nil {\n%s\n}\n", tmp, call, g.fail(v))
+    g.printf("%s = %s(%s)\n", v, g.typeString(t), tmp)
+}
+
+/************************/
+/** End Unmarshal      **/
+/************************/
+
+/**************************/
+/** Start Msgsize        **/
+/**************************/
+
+// Fixed sizes by kind
+var fixedSizes = map[fieldKind]string{
+    kindBool: "msgpack.BoolSize",
+    kindInt: "msgpack.IntSize",
+    kindUint: "msgpack.UintSize",
+    kindFloat32: "msgpack.Float32Size",
+    kindFloat64: "msgpack.Float64Size",
+}
+
+func (g *generator) sizeStruct(name string, fields []field) {
+    g.printf("// Msgsize returns an upper bound of the encoded size of z.\n")
+    g.printf("func (z %s) Msgsize() int {\n", name)
+    g.printf("s := msgpack.HeaderSize\n")
+    for _, f := range fields {
+        g.printf("s += msgpack.HeaderSize + %d\n", len(f.key))
+        g.size(f.typ, "z." + f.name)
+    }
+    g.printf("return s\n}\n\n")
+}
+
+// Method writes the code adding the size of v of type t to s
+func (g *generator) size(t ast.Expr, v string) {
+    k, _ := g.classify(t)
+    if size, ok := fixedSizes[k]; ok {
+        g.printf("s += %s\n", size)
+        return
+    }
+
+    switch k {
+        case kindString, kindBytes:
+            g.printf("s += msgpack.HeaderSize + len(%s)\n", v)
+
+        case kindSlice:
+            //Elements of a fixed size need no loop
+            if size, ok := fixedSizes[g.kindOf(elemOf(t))]; ok {
+                g.printf("s += msgpack.HeaderSize + len(%s)*%s\n", v, size)
+                break
+            }
+
+            e := g.temp("e")
+            g.printf("s += msgpack.HeaderSize\n")
+            g.printf("for _, %s := range %s {\n", e, v)
+            g.size(elemOf(t), e)
+            g.printf("}\n")
+
+        case kindMap:
+            mk, mv := g.temp("k"), g.temp("v")
+            g.printf("s += msgpack.HeaderSize\n")
+            if size, ok := fixedSizes[g.kindOf(elemOf(t))]; ok {
+                g.printf("for %s := range %s {\ns += msgpack.HeaderSize + len(%s)\n}\n", mk, v, mk)
+                g.printf("s += len(%s)*%s\n", v, size)
+                break
+            }
+
+            g.printf("for %s, %s := range %s {\n", mk, mv, v)
+            g.printf("s += msgpack.HeaderSize + len(%s)\n", mk)
+            g.size(elemOf(t), mv)
+            g.printf("}\n")
+
+        case kindPtr:
+            g.printf("if %s == nil {\ns += msgpack.NilSize\n} else {\n", v)
+            g.size(elemOf(t), "(*" + v + ")")
+            g.printf("}\n")
+
+        case kindGenerated:
+            g.printf("s += %s.Msgsize()\n", v)
+        default:
+            g.printf("s += msgpack.InterfaceSize(%s)\n", v)
+    }
+}
+
+// Method returns the kind of a type
+func (g *generator) kindOf(t ast.Expr) fieldKind {
+    k, _ := g.classify(t)
+    return k
+}
+
+/************************/
+/** End Msgsize        **/
+/************************/
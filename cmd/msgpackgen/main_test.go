@@ -0,0 +1,63 @@
+package main
+import (
+    "path/filepath"
+    "os/exec"
+    "testing"
+    "strings"
+    "bytes"
+    "flag"
+    "fmt"
+    "os"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/sample/types_msgpack.go")
+
+// Test the generated sample against its checked in output, then build
+// and run the sample's tests with it
+func TestGenerate(t *testing.T) {
+    file := filepath.Join("testdata", "sample", "types.go")
+    output := filepath.Join("testdata", "sample", "types_msgpack.go")
+    src, err := generate(file, output, nil)
+    if err != nil {
+        panic(err)
+    }
+
+    if *update {
+        if err := os.WriteFile(output, src, 0644); err != nil {
+            panic(err)
+        }
+    }
+
+    golden, err := os.ReadFile(output)
+    if err != nil {
+        panic(err)
+    } else if !bytes.Equal(src, golden) {
+        panic(fmt.Sprintf("%s is out of date, run go test -update", output))
+    }
+
+    gobin, err := exec.LookPath("go")
+    if err != nil {
+        t.Skip("go command not found")
+    }
+
+    out, err := exec.Command(gobin, "test", "./testdata/sample").CombinedOutput()
+    if err != nil {
+        panic(fmt.Sprintf("Generated sample failed:\n%s", out))
+    }
+    t.Log(strings.TrimSpace(string(out)))
+}
+
+// Test choosing types
+func TestGenerateTypes(t *testing.T) {
+    file := filepath.Join("testdata", "sample", "types.go")
+    src, err := generate(file, filepath.Join(t.TempDir(), "out.go"), []string{ "Line" })
+    if err != nil {
+        panic(err)
+    } else if !bytes.Contains(src, []byte("func (z Line) MarshalMsg")) || bytes.Contains(src, []byte("func (z Order)")) {
+        panic(fmt.Sprintf("Expected only Line methods, got\n%s", src))
+    }
+
+    if _, err := generate(file, "out.go", []string{ "Missing" }); err == nil {
+        panic("Expected missing type error")
+    }
+}
@@ -0,0 +1,176 @@
+package sample
+import (
+    "github.com/alzerid/msgpack"
+    "net/url"
+    "testing"
+    "reflect"
+    "errors"
+    "bytes"
+    "fmt"
+    "io"
+)
+
+// Order without the generated methods, encoded by reflection
+type plainOrder Order
+
+// Function returns an order with every field set
+func newOrder() Order {
+    return Order{
+        ID: 1 << 40, Delta: -100, Small: 5, Ratio: 0.5, Paid: true, Note: "n",
+        Data: []byte{ 1, 2 }, Lines: []Line{ { "a", 2, 1.25 }, { "b", 300, 0 } },
+        Totals: map[string]float64{ "net": 9.5 }, Nested: map[string][]int32{ "x": { -1, 70000 } },
+        Next: &Line{ SKU: "next" }, Any: "s", Query: url.Values{ "q": { "1", "2" } },
+        Grid: [][]int64{ { 1, -2 }, {} }, hidden: 3,
+    }
+}
+
+// Test generated methods against the reflection encoder and decoder
+func TestRoundTrip(t *testing.T) {
+    in := newOrder()
+    gen, err := in.MarshalMsg(nil)
+    if err != nil {
+        panic(err)
+    }
+
+    refl, err := msgpack.Marshal(plainOrder(in))
+    if err != nil {
+        panic(err)
+    } else if !bytes.Equal(gen, refl) {
+        panic(fmt.Sprintf("Generated encoding differs from Marshal!\n%x\n%x", gen, refl))
+    } else if len(gen) > in.Msgsize() {
+        panic(fmt.Sprintf("Msgsize %d is less than %d", in.Msgsize(), len(gen)))
+    }
+
+    //Unexported and unnamed omitempty fields are left out, nil bin
+    //decodes empty
+    in.hidden, in.Note, in.Empty = 0, "", []byte{}
+
+    var out Order
+    if rest, err := out.UnmarshalMsg(append(gen, 0xc0)); err != nil {
+        panic(err)
+    } else if !bytes.Equal(rest, []byte{ 0xc0 }) {
+        panic(fmt.Sprintf("Expected the bytes after the value, got %x", rest))
+    } else if !reflect.DeepEqual(in, out) {
+        panic(fmt.Sprintf("Generated decoding mismatch!\n%+v\n%+v", in, out))
+    }
+
+    //nil pointers stay nil whichever decoder runs
+    var plain plainOrder
+    if err := msgpack.Unmarshal(gen, &plain); err != nil {
+        panic(err)
+    } else if plain.Prev != nil {
+        panic(fmt.Sprintf("Expected a nil pointer, got %v", plain.Prev))
+    } else if !reflect.DeepEqual(in, Order(plain)) {
+        panic(fmt.Sprintf("Reflection decoding mismatch!\n%+v\n%+v", in, plain))
+    }
+
+    //Unknown keys are skipped, nil resets, short input fails
+    extra, _ := msgpack.Marshal(map[string]interface{}{ "sku": "z", "color": []int{ 1 } })
+    var line Line
+    if _, err := line.UnmarshalMsg(extra); err != nil || line.SKU != "z" {
+        panic(fmt.Sprintf("Unknown key mismatch! %+v %v", line, err))
+    } else if _, err := line.UnmarshalMsg([]byte{ 0xc0 }); err != nil || line != (Line{}) {
+        panic(fmt.Sprintf("nil mismatch! %+v %v", line, err))
+    } else if _, err := out.UnmarshalMsg(gen[:len(gen)-1]); err != io.ErrUnexpectedEOF {
+        panic(fmt.Sprintf("Expected io.ErrUnexpectedEOF, got %v", err))
+    } else if _, err := line.UnmarshalMsg([]byte{ 0x81, 0xa3, 'q', 't', 'y', 0xd0, 0xff }); err == nil {
+        panic("Expected negative qty error")
+    }
+}
+
+// Test named types through Marshal and Unmarshal, which use the
+// generated methods
+func TestNamedTypes(t *testing.T) {
+    in := Labels{ Level: -2, Tags: map[Tag]Level{ "a": 1 }, Refs: map[string]*Line{ "r": { Qty: 9 }, "none": nil } }
+    data, err := msgpack.Marshal(in)
+    if err != nil {
+        panic(err)
+    }
+
+    out, err := msgpack.UnmarshalT[Labels](data)
+    if err != nil {
+        panic(err)
+    } else if !reflect.DeepEqual(in, out) {
+        panic(fmt.Sprintf("Named types mismatch!\n%+v\n%+v", in, out))
+    }
+
+    if _, err := msgpack.UnmarshalT[Labels]([]byte{ 0x81, 0xa5, 'l', 'e', 'v', 'e', 'l', 0xcc, 0xff }); err == nil {
+        panic("Expected int8 overflow")
+    }
+}
+
+// Function decodes data into a T with the generated methods and with
+// reflection, which a duplicate key policy other than the default
+// falls back to
+func decodeBoth[T any](data []byte) (gen T, refl T, genErr error, reflErr error) {
+    genErr = msgpack.Unmarshal(data, &gen)
+    dec := msgpack.NewDecoder(bytes.NewReader(data))
+    dec.SetDuplicateKeyPolicy(msgpack.DuplicateKeysFirstWins)
+    reflErr = dec.Decode(&refl)
+    return
+}
+
+// Test str and bin decode into both string and []byte fields
+func TestStrBin(t *testing.T) {
+    data, _ := msgpack.Marshal(map[string]interface{}{
+        "data": "xy",
+        "lines": []interface{}{ map[string]interface{}{ "sku": []byte("a") } },
+        "next": map[string]interface{}{ "sku": []byte("b") },
+    })
+
+    gen, refl, genErr, reflErr := decodeBoth[Order](data)
+    if genErr != nil || reflErr != nil {
+        panic(fmt.Sprintf("Decoding failed! %v %v", genErr, reflErr))
+    } else if !reflect.DeepEqual(gen, refl) {
+        panic(fmt.Sprintf("str/bin mismatch!\n%+v\n%+v", gen, refl))
+    } else if string(gen.Data) != "xy" || gen.Lines[0].SKU != "a" || gen.Next.SKU != "b" {
+        panic(fmt.Sprintf("str/bin mismatch! %+v", gen))
+    }
+}
+
+// Test type errors match the ones reflection reports
+func TestTypeErrors(t *testing.T) {
+    enc := func(v interface{}) []byte {
+        data, _ := msgpack.Marshal(v)
+        return data
+    }
+
+    check := func(name string, genErr error, reflErr error) {
+        var terr *msgpack.UnmarshalTypeError
+        if !errors.As(reflErr, &terr) {
+            panic(fmt.Sprintf("%s: expected a type error, got %v", name, reflErr))
+        } else if !reflect.DeepEqual(genErr, reflErr) {
+            panic(fmt.Sprintf("%s: type error mismatch!\n%v\n%v", name, genErr, reflErr))
+        }
+        t.Log(genErr)
+    }
+
+    for _, tc := range []struct{ name string; data []byte }{
+        { "field", enc(map[string]interface{}{ "id": 1, "small": "x" }) },
+        { "nested", enc(map[string]interface{}{ "lines": []interface{}{ map[string]interface{}{}, map[string]interface{}{ "sku": "a", "qty": true } } }) },
+        { "pointer", enc(map[string]interface{}{ "next": "s" }) },
+        { "grid", enc(map[string]interface{}{ "Grid": [][]interface{}{ { 1, "x" } } }) },
+        { "map", enc(map[string]interface{}{ "nested": map[string]interface{}{ "x": []interface{}{ 1, "y" } } }) },
+        { "reflect", enc(map[string]interface{}{ "query": map[string]interface{}{ "q": []interface{}{ 1 } } }) },
+        { "root", enc("s") },
+    }{
+        _, _, genErr, reflErr := decodeBoth[Order](tc.data)
+        check(tc.name, genErr, reflErr)
+    }
+
+    _, _, genErr, reflErr := decodeBoth[[]Line](enc([]interface{}{ map[string]interface{}{ "qty": "x" } }))
+    check("slice", genErr, reflErr)
+
+    _, _, genErr, reflErr = decodeBoth[Labels](enc(map[string]interface{}{ "tags": map[string]interface{}{ "a": "x" } }))
+    check("named", genErr, reflErr)
+
+    //Streams read values before decoding them
+    dec := msgpack.NewDecoder(bytes.NewReader(append(enc(1), enc(map[string]interface{}{ "qty": "x" })...)))
+    var n int
+    var line Line
+    if err := dec.Decode(&n); err != nil {
+        panic(err)
+    } else if err := dec.Decode(&line); err == nil || err.Error() != "msgpack: cannot unmarshal str into Go struct field Line.qty of type uint16 (offset 6)" {
+        panic(fmt.Sprintf("Stream error mismatch! %v", err))
+    }
+}
@@ -0,0 +1,45 @@
+// Package sample holds the types msgpackgen is tested with. Run
+// go test -update in cmd/msgpackgen after changing them.
+package sample
+import (
+    "net/url"
+)
+
+// Line of an order
+type Line struct {
+    SKU string `msgpack:"sku"`
+    Qty uint16 `msgpack:"qty"`
+    Price float64 `msgpack:"price"`
+}
+
+// Order has a field of every kind the generator handles
+type Order struct {
+    ID uint64 `msgpack:"id"`
+    Delta int8 `msgpack:"delta"`
+    Small int `msgpack:"small"`
+    Ratio float32 `msgpack:"ratio"`
+    Paid bool `msgpack:"paid"`
+    Note string `msgpack:",omitempty"`
+    Data []byte `msgpack:"data"`
+    Empty []byte `msgpack:"empty"`
+    Lines []Line `msgpack:"lines"`
+    Totals map[string]float64 `msgpack:"totals"`
+    Nested (map[string][]int32) `msgpack:"nested"`
+    Next *Line `msgpack:"next"`
+    Prev *Line `msgpack:"prev"`
+    Any interface{} `msgpack:"any"`
+    Query url.Values `msgpack:"query"`
+    Grid [][]int64
+    hidden int
+}
+
+// Named types of basic types
+type Level int8
+type Tag string
+
+// Labels converts named types to and from their underlying types
+type Labels struct {
+    Level Level `msgpack:"level"`
+    Tags map[Tag]Level `msgpack:"tags"`
+    Refs map[string]*Line `msgpack:"refs"`
+}
@@ -0,0 +1,697 @@
+// Code generated by msgpackgen. DO NOT EDIT.
+
+package sample
+
+import (
+	"github.com/alzerid/msgpack"
+	"io"
+)
+
+// MarshalMsg appends the msgpack encoding of z to b.
+func (z Line) MarshalMsg(b []byte) (_ []byte, err error) {
+	b = msgpack.AppendMapHeader(b, 3)
+	b = msgpack.AppendString(b, "sku")
+	b = msgpack.AppendString(b, string(z.SKU))
+	b = msgpack.AppendString(b, "qty")
+	b = msgpack.AppendUint(b, uint64(z.Qty))
+	b = msgpack.AppendString(b, "price")
+	b = msgpack.AppendFloat64(b, float64(z.Price))
+	return b, nil
+}
+
+// UnmarshalMsg decodes the msgpack value at the start of b into z
+// and returns the bytes after it.
+func (z *Line) UnmarshalMsg(b []byte) (_ []byte, err error) {
+	if msgpack.IsNil(b) {
+		*z = Line{}
+		return b[1:], nil
+	}
+
+	var n int
+	var key []byte
+	if n, b, err = msgpack.ReadMapHeaderBytes(b); err != nil {
+		return b, err
+	}
+
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		if key, b, err = msgpack.ReadMapKeyBytes(b); err != nil {
+			return b, err
+		}
+
+		switch string(key) {
+		case "sku":
+			if msgpack.IsNil(b) {
+				z.SKU = ""
+				b = b[1:]
+			} else {
+				var zt1 string
+				if zt1, b, err = msgpack.ReadStringBytes(b); err != nil {
+					return b, msgpack.FieldError(err, &z.SKU, "sku")
+				}
+				z.SKU = string(zt1)
+			}
+		case "qty":
+			if msgpack.IsNil(b) {
+				z.Qty = 0
+				b = b[1:]
+			} else {
+				var zt2 uint64
+				if zt2, b, err = msgpack.ReadUintBytes(b, 16); err != nil {
+					return b, msgpack.FieldError(err, &z.Qty, "qty")
+				}
+				z.Qty = uint16(zt2)
+			}
+		case "price":
+			if msgpack.IsNil(b) {
+				z.Price = 0
+				b = b[1:]
+			} else {
+				var zt3 float64
+				if zt3, b, err = msgpack.ReadFloat64Bytes(b); err != nil {
+					return b, msgpack.FieldError(err, &z.Price, "price")
+				}
+				z.Price = float64(zt3)
+			}
+		default:
+			if b, err = msgpack.SkipBytes(b); err != nil {
+				return b, err
+			}
+		}
+	}
+
+	return b, nil
+}
+
+// Msgsize returns an upper bound of the encoded size of z.
+func (z Line) Msgsize() int {
+	s := msgpack.HeaderSize
+	s += msgpack.HeaderSize + 3
+	s += msgpack.HeaderSize + len(z.SKU)
+	s += msgpack.HeaderSize + 3
+	s += msgpack.UintSize
+	s += msgpack.HeaderSize + 5
+	s += msgpack.Float64Size
+	return s
+}
+
+// MarshalMsg appends the msgpack encoding of z to b.
+func (z Order) MarshalMsg(b []byte) (_ []byte, err error) {
+	b = msgpack.AppendMapHeader(b, 15)
+	b = msgpack.AppendString(b, "id")
+	b = msgpack.AppendUint(b, uint64(z.ID))
+	b = msgpack.AppendString(b, "delta")
+	b = msgpack.AppendInt(b, int64(z.Delta))
+	b = msgpack.AppendString(b, "small")
+	b = msgpack.AppendInt(b, int64(z.Small))
+	b = msgpack.AppendString(b, "ratio")
+	b = msgpack.AppendFloat32(b, float32(z.Ratio))
+	b = msgpack.AppendString(b, "paid")
+	b = msgpack.AppendBool(b, bool(z.Paid))
+	b = msgpack.AppendString(b, "data")
+	b = msgpack.AppendBytes(b, []byte(z.Data))
+	b = msgpack.AppendString(b, "empty")
+	b = msgpack.AppendBytes(b, []byte(z.Empty))
+	b = msgpack.AppendString(b, "lines")
+	b = msgpack.AppendArrayHeader(b, len(z.Lines))
+	for _, ze4 := range z.Lines {
+		if b, err = ze4.MarshalMsg(b); err != nil {
+			return b, err
+		}
+	}
+	b = msgpack.AppendString(b, "totals")
+	b = msgpack.AppendMapHeader(b, len(z.Totals))
+	for zk5, zv6 := range z.Totals {
+		b = msgpack.AppendString(b, string(zk5))
+		b = msgpack.AppendFloat64(b, float64(zv6))
+	}
+	b = msgpack.AppendString(b, "nested")
+	b = msgpack.AppendMapHeader(b, len(z.Nested))
+	for zk7, zv8 := range z.Nested {
+		b = msgpack.AppendString(b, string(zk7))
+		b = msgpack.AppendArrayHeader(b, len(zv8))
+		for _, ze9 := range zv8 {
+			b = msgpack.AppendInt(b, int64(ze9))
+		}
+	}
+	b = msgpack.AppendString(b, "next")
+	if z.Next == nil {
+		b = msgpack.AppendNil(b)
+	} else {
+		if b, err = (*z.Next).MarshalMsg(b); err != nil {
+			return b, err
+		}
+	}
+	b = msgpack.AppendString(b, "prev")
+	if z.Prev == nil {
+		b = msgpack.AppendNil(b)
+	} else {
+		if b, err = (*z.Prev).MarshalMsg(b); err != nil {
+			return b, err
+		}
+	}
+	b = msgpack.AppendString(b, "any")
+	if b, err = msgpack.AppendInterface(b, z.Any); err != nil {
+		return b, err
+	}
+	b = msgpack.AppendString(b, "query")
+	if b, err = msgpack.AppendInterface(b, z.Query); err != nil {
+		return b, err
+	}
+	b = msgpack.AppendString(b, "Grid")
+	b = msgpack.AppendArrayHeader(b, len(z.Grid))
+	for _, ze10 := range z.Grid {
+		b = msgpack.AppendArrayHeader(b, len(ze10))
+		for _, ze11 := range ze10 {
+			b = msgpack.AppendInt(b, int64(ze11))
+		}
+	}
+	return b, nil
+}
+
+// UnmarshalMsg decodes the msgpack value at the start of b into z
+// and returns the bytes after it.
+func (z *Order) UnmarshalMsg(b []byte) (_ []byte, err error) {
+	if msgpack.IsNil(b) {
+		*z = Order{}
+		return b[1:], nil
+	}
+
+	var n int
+	var key []byte
+	if n, b, err = msgpack.ReadMapHeaderBytes(b); err != nil {
+		return b, err
+	}
+
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		if key, b, err = msgpack.ReadMapKeyBytes(b); err != nil {
+			return b, err
+		}
+
+		switch string(key) {
+		case "id":
+			if msgpack.IsNil(b) {
+				z.ID = 0
+				b = b[1:]
+			} else {
+				var zt12 uint64
+				if zt12, b, err = msgpack.ReadUintBytes(b, 64); err != nil {
+					return b, msgpack.FieldError(err, &z.ID, "id")
+				}
+				z.ID = uint64(zt12)
+			}
+		case "delta":
+			if msgpack.IsNil(b) {
+				z.Delta = 0
+				b = b[1:]
+			} else {
+				var zt13 int64
+				if zt13, b, err = msgpack.ReadIntBytes(b, 8); err != nil {
+					return b, msgpack.FieldError(err, &z.Delta, "delta")
+				}
+				z.Delta = int8(zt13)
+			}
+		case "small":
+			if msgpack.IsNil(b) {
+				z.Small = 0
+				b = b[1:]
+			} else {
+				var zt14 int64
+				if zt14, b, err = msgpack.ReadIntBytes(b, 0); err != nil {
+					return b, msgpack.FieldError(err, &z.Small, "small")
+				}
+				z.Small = int(zt14)
+			}
+		case "ratio":
+			if msgpack.IsNil(b) {
+				z.Ratio = 0
+				b = b[1:]
+			} else {
+				var zt15 float64
+				if zt15, b, err = msgpack.ReadFloat64Bytes(b); err != nil {
+					return b, msgpack.FieldError(err, &z.Ratio, "ratio")
+				}
+				z.Ratio = float32(zt15)
+			}
+		case "paid":
+			if msgpack.IsNil(b) {
+				z.Paid = false
+				b = b[1:]
+			} else {
+				var zt16 bool
+				if zt16, b, err = msgpack.ReadBoolBytes(b); err != nil {
+					return b, msgpack.FieldError(err, &z.Paid, "paid")
+				}
+				z.Paid = bool(zt16)
+			}
+		case "data":
+			var zt17 []byte
+			if zt17, b, err = msgpack.ReadBytesBytes(b); err != nil {
+				return b, msgpack.FieldError(err, &z.Data, "data")
+			}
+			z.Data = []byte(zt17)
+		case "empty":
+			var zt18 []byte
+			if zt18, b, err = msgpack.ReadBytesBytes(b); err != nil {
+				return b, msgpack.FieldError(err, &z.Empty, "empty")
+			}
+			z.Empty = []byte(zt18)
+		case "lines":
+			if msgpack.IsNil(b) {
+				z.Lines = nil
+				b = b[1:]
+			} else {
+				var zn19 int
+				if zn19, b, err = msgpack.ReadArrayHeaderBytes(b); err != nil {
+					return b, msgpack.FieldError(err, &z.Lines, "lines")
+				}
+				if z.Lines != nil && cap(z.Lines) >= zn19 {
+					z.Lines = z.Lines[:zn19]
+				} else {
+					z.Lines = make([]Line, zn19)
+				}
+				for zi20 := range z.Lines {
+					if b, err = z.Lines[zi20].UnmarshalMsg(b); err != nil {
+						return b, msgpack.FieldError(err, &z.Lines[zi20], "lines", zi20)
+					}
+				}
+			}
+		case "totals":
+			if msgpack.IsNil(b) {
+				z.Totals = nil
+				b = b[1:]
+			} else {
+				var zn21 int
+				if zn21, b, err = msgpack.ReadMapHeaderBytes(b); err != nil {
+					return b, msgpack.FieldError(err, &z.Totals, "totals")
+				}
+				if z.Totals == nil {
+					z.Totals = make(map[string]float64, zn21)
+				}
+				for zi22 := 0; zi22 < zn21; zi22++ {
+					var zk23 string
+					var zv24 float64
+					if msgpack.IsNil(b) {
+						zk23 = ""
+						b = b[1:]
+					} else {
+						var zt25 string
+						if zt25, b, err = msgpack.ReadStringBytes(b); err != nil {
+							return b, msgpack.FieldError(err, &zk23, "totals")
+						}
+						zk23 = string(zt25)
+					}
+					if msgpack.IsNil(b) {
+						zv24 = 0
+						b = b[1:]
+					} else {
+						var zt26 float64
+						if zt26, b, err = msgpack.ReadFloat64Bytes(b); err != nil {
+							return b, msgpack.FieldError(err, &zv24, "totals", zk23)
+						}
+						zv24 = float64(zt26)
+					}
+					z.Totals[zk23] = zv24
+				}
+			}
+		case "nested":
+			if msgpack.IsNil(b) {
+				z.Nested = nil
+				b = b[1:]
+			} else {
+				var zn27 int
+				if zn27, b, err = msgpack.ReadMapHeaderBytes(b); err != nil {
+					return b, msgpack.FieldError(err, &z.Nested, "nested")
+				}
+				if z.Nested == nil {
+					z.Nested = make((map[string][]int32), zn27)
+				}
+				for zi28 := 0; zi28 < zn27; zi28++ {
+					var zk29 string
+					var zv30 []int32
+					if msgpack.IsNil(b) {
+						zk29 = ""
+						b = b[1:]
+					} else {
+						var zt31 string
+						if zt31, b, err = msgpack.ReadStringBytes(b); err != nil {
+							return b, msgpack.FieldError(err, &zk29, "nested")
+						}
+						zk29 = string(zt31)
+					}
+					if msgpack.IsNil(b) {
+						zv30 = nil
+						b = b[1:]
+					} else {
+						var zn32 int
+						if zn32, b, err = msgpack.ReadArrayHeaderBytes(b); err != nil {
+							return b, msgpack.FieldError(err, &zv30, "nested", zk29)
+						}
+						if zv30 != nil && cap(zv30) >= zn32 {
+							zv30 = zv30[:zn32]
+						} else {
+							zv30 = make([]int32, zn32)
+						}
+						for zi33 := range zv30 {
+							if msgpack.IsNil(b) {
+								zv30[zi33] = 0
+								b = b[1:]
+							} else {
+								var zt34 int64
+								if zt34, b, err = msgpack.ReadIntBytes(b, 32); err != nil {
+									return b, msgpack.FieldError(err, &zv30[zi33], "nested", zk29, zi33)
+								}
+								zv30[zi33] = int32(zt34)
+							}
+						}
+					}
+					z.Nested[zk29] = zv30
+				}
+			}
+		case "next":
+			if msgpack.IsNil(b) {
+				z.Next = nil
+				b = b[1:]
+			} else {
+				if z.Next == nil {
+					z.Next = new(Line)
+				}
+				if b, err = (*z.Next).UnmarshalMsg(b); err != nil {
+					return b, msgpack.FieldError(err, &(*z.Next), "next")
+				}
+			}
+		case "prev":
+			if msgpack.IsNil(b) {
+				z.Prev = nil
+				b = b[1:]
+			} else {
+				if z.Prev == nil {
+					z.Prev = new(Line)
+				}
+				if b, err = (*z.Prev).UnmarshalMsg(b); err != nil {
+					return b, msgpack.FieldError(err, &(*z.Prev), "prev")
+				}
+			}
+		case "any":
+			if b, err = msgpack.UnmarshalNext(b, &z.Any); err != nil {
+				return b, msgpack.FieldError(err, &z.Any, "any")
+			}
+		case "query":
+			if b, err = msgpack.UnmarshalNext(b, &z.Query); err != nil {
+				return b, msgpack.FieldError(err, &z.Query, "query")
+			}
+		case "Grid":
+			if msgpack.IsNil(b) {
+				z.Grid = nil
+				b = b[1:]
+			} else {
+				var zn35 int
+				if zn35, b, err = msgpack.ReadArrayHeaderBytes(b); err != nil {
+					return b, msgpack.FieldError(err, &z.Grid, "Grid")
+				}
+				if z.Grid != nil && cap(z.Grid) >= zn35 {
+					z.Grid = z.Grid[:zn35]
+				} else {
+					z.Grid = make([][]int64, zn35)
+				}
+				for zi36 := range z.Grid {
+					if msgpack.IsNil(b) {
+						z.Grid[zi36] = nil
+						b = b[1:]
+					} else {
+						var zn37 int
+						if zn37, b, err = msgpack.ReadArrayHeaderBytes(b); err != nil {
+							return b, msgpack.FieldError(err, &z.Grid[zi36], "Grid", zi36)
+						}
+						if z.Grid[zi36] != nil && cap(z.Grid[zi36]) >= zn37 {
+							z.Grid[zi36] = z.Grid[zi36][:zn37]
+						} else {
+							z.Grid[zi36] = make([]int64, zn37)
+						}
+						for zi38 := range z.Grid[zi36] {
+							if msgpack.IsNil(b) {
+								z.Grid[zi36][zi38] = 0
+								b = b[1:]
+							} else {
+								var zt39 int64
+								if zt39, b, err = msgpack.ReadIntBytes(b, 64); err != nil {
+									return b, msgpack.FieldError(err, &z.Grid[zi36][zi38], "Grid", zi36, zi38)
+								}
+								z.Grid[zi36][zi38] = int64(zt39)
+							}
+						}
+					}
+				}
+			}
+		default:
+			if b, err = msgpack.SkipBytes(b); err != nil {
+				return b, err
+			}
+		}
+	}
+
+	return b, nil
+}
+
+// Msgsize returns an upper bound of the encoded size of z.
+func (z Order) Msgsize() int {
+	s := msgpack.HeaderSize
+	s += msgpack.HeaderSize + 2
+	s += msgpack.UintSize
+	s += msgpack.HeaderSize + 5
+	s += msgpack.IntSize
+	s += msgpack.HeaderSize + 5
+	s += msgpack.IntSize
+	s += msgpack.HeaderSize + 5
+	s += msgpack.Float32Size
+	s += msgpack.HeaderSize + 4
+	s += msgpack.BoolSize
+	s += msgpack.HeaderSize + 4
+	s += msgpack.HeaderSize + len(z.Data)
+	s += msgpack.HeaderSize + 5
+	s += msgpack.HeaderSize + len(z.Empty)
+	s += msgpack.HeaderSize + 5
+	s += msgpack.HeaderSize
+	for _, ze40 := range z.Lines {
+		s += ze40.Msgsize()
+	}
+	s += msgpack.HeaderSize + 6
+	s += msgpack.HeaderSize
+	for zk41 := range z.Totals {
+		s += msgpack.HeaderSize + len(zk41)
+	}
+	s += len(z.Totals) * msgpack.Float64Size
+	s += msgpack.HeaderSize + 6
+	s += msgpack.HeaderSize
+	for zk43, zv44 := range z.Nested {
+		s += msgpack.HeaderSize + len(zk43)
+		s += msgpack.HeaderSize + len(zv44)*msgpack.IntSize
+	}
+	s += msgpack.HeaderSize + 4
+	if z.Next == nil {
+		s += msgpack.NilSize
+	} else {
+		s += (*z.Next).Msgsize()
+	}
+	s += msgpack.HeaderSize + 4
+	if z.Prev == nil {
+		s += msgpack.NilSize
+	} else {
+		s += (*z.Prev).Msgsize()
+	}
+	s += msgpack.HeaderSize + 3
+	s += msgpack.InterfaceSize(z.Any)
+	s += msgpack.HeaderSize + 5
+	s += msgpack.InterfaceSize(z.Query)
+	s += msgpack.HeaderSize + 4
+	s += msgpack.HeaderSize
+	for _, ze45 := range z.Grid {
+		s += msgpack.HeaderSize + len(ze45)*msgpack.IntSize
+	}
+	return s
+}
+
+// MarshalMsg appends the msgpack encoding of z to b.
+func (z Labels) MarshalMsg(b []byte) (_ []byte, err error) {
+	b = msgpack.AppendMapHeader(b, 3)
+	b = msgpack.AppendString(b, "level")
+	b = msgpack.AppendInt(b, int64(z.Level))
+	b = msgpack.AppendString(b, "tags")
+	b = msgpack.AppendMapHeader(b, len(z.Tags))
+	for zk46, zv47 := range z.Tags {
+		b = msgpack.AppendString(b, string(zk46))
+		b = msgpack.AppendInt(b, int64(zv47))
+	}
+	b = msgpack.AppendString(b, "refs")
+	b = msgpack.AppendMapHeader(b, len(z.Refs))
+	for zk48, zv49 := range z.Refs {
+		b = msgpack.AppendString(b, string(zk48))
+		if zv49 == nil {
+			b = msgpack.AppendNil(b)
+		} else {
+			if b, err = (*zv49).MarshalMsg(b); err != nil {
+				return b, err
+			}
+		}
+	}
+	return b, nil
+}
+
+// UnmarshalMsg decodes the msgpack value at the start of b into z
+// and returns the bytes after it.
+func (z *Labels) UnmarshalMsg(b []byte) (_ []byte, err error) {
+	if msgpack.IsNil(b) {
+		*z = Labels{}
+		return b[1:], nil
+	}
+
+	var n int
+	var key []byte
+	if n, b, err = msgpack.ReadMapHeaderBytes(b); err != nil {
+		return b, err
+	}
+
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		if key, b, err = msgpack.ReadMapKeyBytes(b); err != nil {
+			return b, err
+		}
+
+		switch string(key) {
+		case "level":
+			if msgpack.IsNil(b) {
+				z.Level = 0
+				b = b[1:]
+			} else {
+				var zt50 int64
+				if zt50, b, err = msgpack.ReadIntBytes(b, 8); err != nil {
+					return b, msgpack.FieldError(err, &z.Level, "level")
+				}
+				z.Level = Level(zt50)
+			}
+		case "tags":
+			if msgpack.IsNil(b) {
+				z.Tags = nil
+				b = b[1:]
+			} else {
+				var zn51 int
+				if zn51, b, err = msgpack.ReadMapHeaderBytes(b); err != nil {
+					return b, msgpack.FieldError(err, &z.Tags, "tags")
+				}
+				if z.Tags == nil {
+					z.Tags = make(map[Tag]Level, zn51)
+				}
+				for zi52 := 0; zi52 < zn51; zi52++ {
+					var zk53 Tag
+					var zv54 Level
+					if msgpack.IsNil(b) {
+						zk53 = ""
+						b = b[1:]
+					} else {
+						var zt55 string
+						if zt55, b, err = msgpack.ReadStringBytes(b); err != nil {
+							return b, msgpack.FieldError(err, &zk53, "tags")
+						}
+						zk53 = Tag(zt55)
+					}
+					if msgpack.IsNil(b) {
+						zv54 = 0
+						b = b[1:]
+					} else {
+						var zt56 int64
+						if zt56, b, err = msgpack.ReadIntBytes(b, 8); err != nil {
+							return b, msgpack.FieldError(err, &zv54, "tags", zk53)
+						}
+						zv54 = Level(zt56)
+					}
+					z.Tags[zk53] = zv54
+				}
+			}
+		case "refs":
+			if msgpack.IsNil(b) {
+				z.Refs = nil
+				b = b[1:]
+			} else {
+				var zn57 int
+				if zn57, b, err = msgpack.ReadMapHeaderBytes(b); err != nil {
+					return b, msgpack.FieldError(err, &z.Refs, "refs")
+				}
+				if z.Refs == nil {
+					z.Refs = make(map[string]*Line, zn57)
+				}
+				for zi58 := 0; zi58 < zn57; zi58++ {
+					var zk59 string
+					var zv60 *Line
+					if msgpack.IsNil(b) {
+						zk59 = ""
+						b = b[1:]
+					} else {
+						var zt61 string
+						if zt61, b, err = msgpack.ReadStringBytes(b); err != nil {
+							return b, msgpack.FieldError(err, &zk59, "refs")
+						}
+						zk59 = string(zt61)
+					}
+					if msgpack.IsNil(b) {
+						zv60 = nil
+						b = b[1:]
+					} else {
+						if zv60 == nil {
+							zv60 = new(Line)
+						}
+						if b, err = (*zv60).UnmarshalMsg(b); err != nil {
+							return b, msgpack.FieldError(err, &(*zv60), "refs", zk59)
+						}
+					}
+					z.Refs[zk59] = zv60
+				}
+			}
+		default:
+			if b, err = msgpack.SkipBytes(b); err != nil {
+				return b, err
+			}
+		}
+	}
+
+	return b, nil
+}
+
+// Msgsize returns an upper bound of the encoded size of z.
+func (z Labels) Msgsize() int {
+	s := msgpack.HeaderSize
+	s += msgpack.HeaderSize + 5
+	s += msgpack.IntSize
+	s += msgpack.HeaderSize + 4
+	s += msgpack.HeaderSize
+	for zk62 := range z.Tags {
+		s += msgpack.HeaderSize + len(zk62)
+	}
+	s += len(z.Tags) * msgpack.IntSize
+	s += msgpack.HeaderSize + 4
+	s += msgpack.HeaderSize
+	for zk64, zv65 := range z.Refs {
+		s += msgpack.HeaderSize + len(zk64)
+		if zv65 == nil {
+			s += msgpack.NilSize
+		} else {
+			s += (*zv65).Msgsize()
+		}
+	}
+	return s
+}
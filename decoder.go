@@ -1,8 +1,13 @@
 package msgpack
 import (
+    "encoding/binary"
     "reflect"
     "unsafe"
+    "strings"
+    "sync"
     "bytes"
+    "math"
+    "fmt"
     "io"
 )
 
@@ -12,25 +17,153 @@ type Unmarshaler interface {
 
 type Token interface{}
 
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+// Token returned at the start of an array. The value is the
+// number of elements that follow.
+type ArrayStart int
+
+// Token returned at the start of a map. The value is the
+// number of key/value pairs that follow.
+type MapStart int
+
+// Token returned for ext values: an application defined
+// type and its raw data
+type Ext struct {
+    Type int8
+    Data []byte
+}
+
+// Policy used when a map key appears more than once
+type DuplicateKeyPolicy int
+
+const (
+    DuplicateKeysLastWins DuplicateKeyPolicy = iota  // Later values overwrite earlier ones (default)
+    DuplicateKeysFirstWins                            // Later values are discarded
+    DuplicateKeysError                                // Decoding fails with a *DuplicateKeyError
+)
+
+// Error returned when a map key matches no struct field and
+// DisallowUnknownFields is set
+type UnknownFieldError struct {
+    Key string   // Offending key
+    Path string  // Path of the struct the key was found in
+}
+
+func (e *UnknownFieldError) Error() string {
+    if e.Path == "" {
+        return fmt.Sprintf("msgpack: unknown field %q", e.Key)
+    }
+
+    return fmt.Sprintf("msgpack: unknown field %q in %s", e.Key, e.Path)
+}
+
+// Error returned when a map key is repeated and the decoder
+// uses the DuplicateKeysError policy
+type DuplicateKeyError struct {
+    Key string   // Offending key
+    Path string  // Path of the map or struct the key was found in
+}
+
+func (e *DuplicateKeyError) Error() string {
+    if e.Path == "" {
+        return fmt.Sprintf("msgpack: duplicate key %q", e.Key)
+    }
+
+    return fmt.Sprintf("msgpack: duplicate key %q in %s", e.Key, e.Path)
+}
+
+// Error returned when a msgpack value cannot be stored in the
+// destination Go value
+type UnmarshalTypeError struct {
+    Value string        // msgpack value, e.g. "str" or "uint 300"
+    Type reflect.Type   // Type of the Go value it could not be assigned to
+    Offset int64        // Offset of the msgpack value in the input
+    Struct string       // Name of the root struct type
+    Field string        // Path from the root to the field, e.g. items[3].price
+}
+
+func (e *UnmarshalTypeError) Error() string {
+    if e.Field != "" {
+        field := e.Field
+        if e.Struct != "" {
+            field = e.Struct + "." + field
+        }
+
+        return fmt.Sprintf("msgpack: cannot unmarshal %s into Go struct field %s of type %v (offset %d)", e.Value, field, e.Type, e.Offset)
+    }
+
+    return fmt.Sprintf("msgpack: cannot unmarshal %s into Go value of type %v (offset %d)", e.Value, e.Type, e.Offset)
+}
+
+// Error returned when the input is not valid msgpack
+type SyntaxError struct {
+    msg string
+    Offset int64  // Offset of the offending byte
+}
+
+func (e *SyntaxError) Error() string {
+    return fmt.Sprintf("msgpack: %s (offset %d)", e.msg, e.Offset)
+}
+
+// Error returned when the input exceeds one of the decoder's
+// DecoderLimits
+type LimitError struct {
+    Limit string   // Name of the DecoderLimits field, e.g. "MaxDepth"
+    Value int64    // Declared or reached value
+    Max int64      // Configured maximum
+    Offset int64   // Offset of the value that exceeded the limit
+}
+
+func (e *LimitError) Error() string {
+    return fmt.Sprintf("msgpack: %d exceeds %s of %d (offset %d)", e.Value, e.Limit, e.Max, e.Offset)
+}
+
 type fixInt int8
 type fixUint uint8
 
+// Size of the Decoder's internal read buffer
+const decoderBufSize = 4096
+
 /**************************/
 /** Start Misc Functions **/
 /**************************/
 
-// Function reads one byte of data
-func readByte(rdr io.Reader) (byte, error) {
-    if brdr, ok := rdr.(io.ByteReader); ok {
-        return brdr.ReadByte()
+// Encoded fields of a struct type, with key names following
+// the "msgpack" tag rules
+type structPlan struct {
+    keys []string         // Keys in field order
+    index []int           // Field index of each key
+    byKey map[string]int  // Field index by key
+}
+
+// Function works out the encoded fields of a struct type
+func newStructPlan(t reflect.Type) *structPlan {
+    sp := &structPlan{ byKey: make(map[string]int, t.NumField()) }
+    for i:=0; i<t.NumField(); i++ {
+        if key, ok := StructFieldKey(t.Field(i)); ok {
+            sp.keys = append(sp.keys, key)
+            sp.index = append(sp.index, i)
+            sp.byKey[key] = i
+        }
     }
 
-    buf := make([]byte, 1)
-    if _, err := rdr.Read(buf); err != nil {
-        return buf[0], err
+    return sp
+}
+
+// Plans of struct types worked out on first use, shared by every
+// Encoder and Decoder
+var structPlans sync.Map
+
+// Function returns the plan of a struct type from the cache,
+// working it out the first time
+func cachedStructPlan(t reflect.Type) *structPlan {
+    if sp, ok := structPlans.Load(t); ok {
+        return sp.(*structPlan)
     }
 
-    return buf[0], nil
+    sp, _ := structPlans.LoadOrStore(t, newStructPlan(t))
+    return sp.(*structPlan)
 }
 
 /************************/
@@ -40,15 +173,354 @@ func readByte(rdr io.Reader) (byte, error) {
 /*******************/
 /** Start Decoder **/
 /*******************/
+
+// Option passed to NewDecoder and Unmarshal
+type DecoderOption interface {
+    apply(d *Decoder)
+}
+
+// Limits protecting the decoder against hostile input. Lengths
+// are checked against the declared header before anything is
+// allocated. Zero means no limit.
+type DecoderLimits struct {
+    MaxDepth int          // Nesting depth of arrays and maps
+    MaxContainerLen int   // Elements of an array or pairs of a map
+    MaxDataLen int        // Bytes of a single str or bin
+    MaxBytes int64        // Total bytes read by the decoder
+}
+
+func (l DecoderLimits) apply(d *Decoder) {
+    d.limits = l
+}
+
 type Decoder struct {
     rdr io.Reader
-    eof bool
+    eof bool      // Reader returned io.EOF
+    buf []byte    // Buffered input, buf[r:w] is unread
+    r, w int
     k Kind
+    off int64     // Bytes consumed so far
+    tokOff int64  // Offset of the last token read
+
+    disallowUnknown bool
+    dupPolicy DuplicateKeyPolicy
+    path []string
+
+    limits DecoderLimits
+    depth int
+
+    scratch [64]byte  // Reused for lengths and skipped data
+
+    recording bool    // Append everything read to raw
+    raw []byte
+}
+
+// Function creates a new decoder. The decoder buffers its
+// input and may read past the values it decodes.
+func NewDecoder(r io.Reader, opts ...DecoderOption) *Decoder {
+    d := &Decoder{ rdr: r }
+    for _, opt := range opts {
+        opt.apply(d)
+    }
+
+    return d
+}
+
+// Function creates a decoder reading directly from data
+func newBytesDecoder(data []byte, opts ...DecoderOption) *Decoder {
+    d := NewDecoder(nil, opts...)
+    d.buf, d.w, d.eof = data, len(data), true
+    return d
+}
+
+// Method makes Decode return an *UnknownFieldError when a
+// map key matches no field of the destination struct
+func (d *Decoder) DisallowUnknownFields() {
+    d.disallowUnknown = true
+}
+
+// Method sets how repeated map keys are handled
+func (d *Decoder) SetDuplicateKeyPolicy(p DuplicateKeyPolicy) {
+    d.dupPolicy = p
+}
+
+// Method checks a value against one of the limits
+func (d *Decoder) checkLimit(limit string, v int64, max int64) error {
+    if max > 0 && v > max {
+        return &LimitError{ limit, v, max, d.tokOff }
+    }
+
+    return nil
+}
+
+// Method reads more input into the buffer, keeping the unread
+// part. Returns io.EOF once the reader is exhausted.
+func (d *Decoder) fill() error {
+    if d.eof {
+        return io.EOF
+    }
+
+    //Move the unread part to the front
+    if d.r > 0 {
+        d.w = copy(d.buf, d.buf[d.r:d.w])
+        d.r = 0
+    }
+
+    if d.buf == nil {
+        d.buf = make([]byte, decoderBufSize)
+    }
+
+    //Readers may return no data without an error
+    for i:=0; i<100; i++ {
+        n, err := d.rdr.Read(d.buf[d.w:])
+        d.w += n
+        if err == io.EOF {
+            d.eof = true
+        }
+
+        if n > 0 {
+            return nil
+        } else if err != nil {
+            return err
+        }
+    }
+
+    return io.ErrNoProgress
+}
+
+// Method consumes n buffered bytes
+func (d *Decoder) consume(n int) []byte {
+    b := d.buf[d.r:d.r+n]
+    d.r += n
+    d.off += int64(n)
+    if d.recording {
+        d.raw = append(d.raw, b...)
+    }
+
+    return b
+}
+
+// Method reads one byte and counts it
+func (d *Decoder) readByte() (byte, error) {
+    if err := d.checkLimit("MaxBytes", d.off+1, d.limits.MaxBytes); err != nil {
+        return 0, err
+    }
+
+    if d.r == d.w {
+        if err := d.fill(); err != nil {
+            return 0, err
+        }
+    }
+
+    return d.consume(1)[0], nil
+}
+
+// Method reads exactly len(buf) bytes. Running out of data is
+// always unexpected here as the value has already started.
+func (d *Decoder) read(buf []byte) error {
+    if err := d.checkLimit("MaxBytes", d.off+int64(len(buf)), d.limits.MaxBytes); err != nil {
+        return err
+    }
+
+    for n := 0; n < len(buf); {
+        if d.r == d.w {
+            if err := d.fill(); err == io.EOF {
+                return io.ErrUnexpectedEOF
+            } else if err != nil {
+                return err
+            }
+        }
+
+        n += copy(buf[n:], d.consume(min(len(buf)-n, d.w-d.r)))
+    }
+
+    return nil
+}
+
+// Method reads a big endian length of size bytes
+func (d *Decoder) readLen(size int) (int, error) {
+    buf := d.scratch[:4]
+    buf[0], buf[1], buf[2] = 0, 0, 0
+    if err := d.read(buf[4-size:]); err != nil {
+        return 0, err
+    }
+
+    return int(binary.BigEndian.Uint32(buf)), nil
+}
+
+// Method reads a str or bin payload of l bytes, checking
+// the limits before allocating
+func (d *Decoder) readData(l int) ([]byte, error) {
+    if err := d.checkLimit("MaxDataLen", int64(l), int64(d.limits.MaxDataLen)); err != nil {
+        return nil, err
+    } else if err := d.checkLimit("MaxBytes", d.off+int64(l), d.limits.MaxBytes); err != nil {
+        return nil, err
+    }
+
+    //Large payloads bypass the buffer once it is drained
+    buf := make([]byte, l)
+    n := copy(buf, d.consume(min(l, d.w-d.r)))
+    if n < l && l-n >= decoderBufSize && !d.eof {
+        m, err := io.ReadFull(d.rdr, buf[n:])
+        d.off += int64(m)
+        if d.recording {
+            d.raw = append(d.raw, buf[n:n+m]...)
+        }
+
+        if err == io.EOF {
+            d.eof = true
+            err = io.ErrUnexpectedEOF
+        } else if err == io.ErrUnexpectedEOF {
+            d.eof = true
+        }
+
+        if err != nil {
+            return nil, err
+        }
+
+        return buf, nil
+    }
+
+    if err := d.read(buf[n:]); err != nil {
+        return nil, err
+    }
+
+    return buf, nil
+}
+
+// Method reads the type byte and l bytes of ext data
+func (d *Decoder) readExt(k Kind, l int) (Token, error) {
+    typ, err := d.readByte()
+    if err == io.EOF {
+        return nil, io.ErrUnexpectedEOF
+    } else if err != nil {
+        return nil, err
+    }
+
+    b, err := d.readData(l)
+    if err != nil {
+        return nil, err
+    }
+
+    d.k = k
+    return Ext{ int8(typ), b }, nil
+}
+
+// Method discards n bytes of input without allocating
+func (d *Decoder) skipBytes(n int) error {
+    if err := d.checkLimit("MaxBytes", d.off+int64(n), d.limits.MaxBytes); err != nil {
+        return err
+    }
+
+    for n > 0 {
+        if d.r == d.w {
+            if err := d.fill(); err == io.EOF {
+                return io.ErrUnexpectedEOF
+            } else if err != nil {
+                return err
+            }
+        }
+
+        n -= len(d.consume(min(n, d.w-d.r)))
+    }
+
+    return nil
+}
+
+// Method reads the header of the next value and returns the
+// number of nested values and payload bytes that follow it
+func (d *Decoder) readHeader() (children int, data int, err error) {
+    d.tokOff = d.off
+    cbyte, err := d.readByte()
+    if err != nil {
+        return 0, 0, err
+    }
+
+    k := kindOf(cbyte)
+    switch {
+        case k == Nil || k == False || k == True || k == FixInt || k == FixUint:
+        case k == Uint8 || k == Int8:
+            data = 1
+        case k == Uint16 || k == Int16:
+            data = 2
+        case k == Uint32 || k == Int32 || k == Float32:
+            data = 4
+        case k == Uint64 || k == Int64 || k == Float64:
+            data = 8
+
+        case k == FixStr:
+            data = int(cbyte & 0x1f)
+        case k >= Str8 && k <= Str32:
+            data, err = d.readLen(1 << (cbyte - byte(Str8)))
+        case k >= Bin8 && k <= Bin32:
+            data, err = d.readLen(1 << (cbyte - byte(Bin8)))
+        case k >= FixExt1 && k <= FixExt16:
+            data = 1 << (cbyte - byte(FixExt1))
+        case k >= Ext8 && k <= Ext32:
+            data, err = d.readLen(1 << (cbyte - byte(Ext8)))
+
+        case k == FixArray || k == FixMap:
+            children = int(cbyte & 0x0f)
+        case k == Array16 || k == Array32:
+            children, err = d.readLen(2 << (cbyte - byte(Array16)))
+        case k == Map16 || k == Map32:
+            children, err = d.readLen(2 << (cbyte - byte(Map16)))
+
+        default:
+            return 0, 0, &SyntaxError{ fmt.Sprintf("invalid control byte 0x%02x", cbyte), d.tokOff }
+    }
+
+    if err != nil {
+        return 0, 0, err
+    }
+
+    //Check the declared lengths
+    d.k = k
+    switch k.Type() {
+        case ArrayType:
+            err = d.checkLimit("MaxContainerLen", int64(children), int64(d.limits.MaxContainerLen))
+        case MapType:
+            err = d.checkLimit("MaxContainerLen", int64(children), int64(d.limits.MaxContainerLen))
+            children *= 2
+        case StringType, BinType:
+            err = d.checkLimit("MaxDataLen", int64(data), int64(d.limits.MaxDataLen))
+        case ExtType:
+            //Ext data is preceded by its type byte
+            err = d.checkLimit("MaxDataLen", int64(data), int64(d.limits.MaxDataLen))
+            data++
+    }
+
+    return children, data, err
 }
 
-// Function creates a new decoder
-func NewDecoder(r io.Reader) *Decoder {
-    return &Decoder{ rdr: r }
+// Method consumes exactly one complete value, including any
+// nested arrays, maps and ext data, without materializing it.
+// Skip uses constant memory so MaxDepth does not apply.
+func (d *Decoder) Skip() error {
+    start := d.off
+    var k Kind
+    for remaining := 1; remaining > 0; remaining-- {
+        children, data, err := d.readHeader()
+        if err == io.EOF && d.off > start {
+            return io.ErrUnexpectedEOF
+        } else if err != nil {
+            return err
+        }
+
+        if err := d.skipBytes(data); err != nil {
+            return err
+        }
+
+        //Kind reports the skipped value, not its contents
+        if d.tokOff == start {
+            k = d.k
+        }
+
+        remaining += children
+    }
+
+    d.k = k
+    return nil
 }
 
 // Method walks the reader and returns the token. Token
@@ -56,7 +528,8 @@ func NewDecoder(r io.Reader) *Decoder {
 // of array, 
 func (d *Decoder) Token() (Token, error) {
     // Read for control byte
-    cbyte, err := readByte(d.rdr)
+    d.tokOff = d.off
+    cbyte, err := d.readByte()
     if err != nil {
         return nil, err
     }
@@ -68,7 +541,7 @@ func (d *Decoder) Token() (Token, error) {
         //Unsigned integers
         case Uint64:
             var buf [8]byte
-            if _, err := d.rdr.Read(buf[:]); err != nil {
+            if err := d.read(buf[:]); err != nil {
                 return nil, err
             }
 
@@ -79,7 +552,7 @@ func (d *Decoder) Token() (Token, error) {
 
         case Uint32:
             var buf [4]byte
-            if _, err := d.rdr.Read(buf[:]); err != nil {
+            if err := d.read(buf[:]); err != nil {
                 return nil, err
             }
 
@@ -90,7 +563,7 @@ func (d *Decoder) Token() (Token, error) {
 
         case Uint16:
             var buf [2]byte
-            if _, err := d.rdr.Read(buf[:]); err != nil {
+            if err := d.read(buf[:]); err != nil {
                 return nil, err
             }
 
@@ -101,7 +574,7 @@ func (d *Decoder) Token() (Token, error) {
 
         case Uint8:
             var buf [1]byte
-            if _, err := d.rdr.Read(buf[:]); err != nil {
+            if err := d.read(buf[:]); err != nil {
                 return nil, err
             }
 
@@ -113,7 +586,7 @@ func (d *Decoder) Token() (Token, error) {
         //Signed
         case Int64:
             var buf [8]byte
-            if _, err := d.rdr.Read(buf[:]); err != nil {
+            if err := d.read(buf[:]); err != nil {
                 return nil, err
             }
 
@@ -124,7 +597,7 @@ func (d *Decoder) Token() (Token, error) {
 
         case Int32:
             var buf [4]byte
-            if _, err := d.rdr.Read(buf[:]); err != nil {
+            if err := d.read(buf[:]); err != nil {
                 return nil, err
             }
 
@@ -135,7 +608,7 @@ func (d *Decoder) Token() (Token, error) {
 
         case Int16:
             var buf [2]byte
-            if _, err := d.rdr.Read(buf[:]); err != nil {
+            if err := d.read(buf[:]); err != nil {
                 return nil, err
             }
 
@@ -146,13 +619,148 @@ func (d *Decoder) Token() (Token, error) {
 
         case Int8:
             var buf [1]byte
-            if _, err := d.rdr.Read(buf[:]); err != nil {
+            if err := d.read(buf[:]); err != nil {
                 return nil, err
             }
 
             d.k = Int8
             ret := (*int8)(unsafe.Pointer(&buf))
             return Token(*ret), nil
+
+        //Nil and booleans
+        case Nil:
+            d.k = Nil
+            return nil, nil
+
+        case False:
+            d.k = False
+            return false, nil
+
+        case True:
+            d.k = True
+            return true, nil
+
+        //Floats
+        case Float32:
+            var buf [4]byte
+            if err := d.read(buf[:]); err != nil {
+                return nil, err
+            }
+
+            d.k = Float32
+            reverseByte(buf[:])
+            ret := (*float32)(unsafe.Pointer(&buf))
+            return Token(*ret), nil
+
+        case Float64:
+            var buf [8]byte
+            if err := d.read(buf[:]); err != nil {
+                return nil, err
+            }
+
+            d.k = Float64
+            reverseByte(buf[:])
+            ret := (*float64)(unsafe.Pointer(&buf))
+            return Token(*ret), nil
+
+        //Strings
+        case Str8, Str16, Str32:
+            l, err := d.readLen(1 << (cbyte - byte(Str8)))
+            if err != nil {
+                return nil, err
+            }
+
+            b, err := d.readData(l)
+            if err != nil {
+                return nil, err
+            }
+
+            d.k = Kind(cbyte)
+            return string(b), nil
+
+        //Binary
+        case Bin8, Bin16, Bin32:
+            l, err := d.readLen(1 << (cbyte - byte(Bin8)))
+            if err != nil {
+                return nil, err
+            }
+
+            b, err := d.readData(l)
+            if err != nil {
+                return nil, err
+            }
+
+            d.k = Kind(cbyte)
+            return b, nil
+
+        //Arrays
+        case Array16, Array32:
+            l, err := d.readLen(2 << (cbyte - byte(Array16)))
+            if err != nil {
+                return nil, err
+            }
+
+            if err := d.checkLimit("MaxContainerLen", int64(l), int64(d.limits.MaxContainerLen)); err != nil {
+                return nil, err
+            }
+
+            d.k = Kind(cbyte)
+            return ArrayStart(l), nil
+
+        //Maps
+        case Map16, Map32:
+            l, err := d.readLen(2 << (cbyte - byte(Map16)))
+            if err != nil {
+                return nil, err
+            }
+
+            if err := d.checkLimit("MaxContainerLen", int64(l), int64(d.limits.MaxContainerLen)); err != nil {
+                return nil, err
+            }
+
+            d.k = Kind(cbyte)
+            return MapStart(l), nil
+
+        //Extensions
+        case FixExt1, FixExt2, FixExt4, FixExt8, FixExt16:
+            return d.readExt(Kind(cbyte), 1 << (cbyte - byte(FixExt1)))
+
+        case Ext8, Ext16, Ext32:
+            l, err := d.readLen(1 << (cbyte - byte(Ext8)))
+            if err != nil {
+                return nil, err
+            }
+
+            return d.readExt(Kind(cbyte), l)
+    }
+
+    //Fix containers and strings
+    switch Kind(cbyte & 0xf0) {
+        case FixMap:
+            if err := d.checkLimit("MaxContainerLen", int64(cbyte & 0x0f), int64(d.limits.MaxContainerLen)); err != nil {
+                return nil, err
+            }
+
+            d.k = FixMap
+            return MapStart(cbyte & 0x0f), nil
+
+        case FixArray:
+            if err := d.checkLimit("MaxContainerLen", int64(cbyte & 0x0f), int64(d.limits.MaxContainerLen)); err != nil {
+                return nil, err
+            }
+
+            d.k = FixArray
+            return ArrayStart(cbyte & 0x0f), nil
+    }
+
+    if Kind(cbyte & 0xe0) == FixStr {
+        b, err := d.readData(int(cbyte & 0x1f))
+        if err != nil {
+            return nil, err
+        }
+
+        d.k = FixStr
+        return string(b), nil
     }
 
     //Fix num
@@ -163,79 +771,911 @@ func (d *Decoder) Token() (Token, error) {
     } else if Kind(cbyte) & FixInt == FixInt {
         d.k = FixInt
 
-        //Ones compliment the number
-        ret := *(*uint8)(unsafe.Pointer(&cbyte)) & (^(uint8(FixInt)))
-        ret = (ret ^ 0xff) + 1
-        return int8(ret), nil
+        //The control byte is the two's compliment value
+        return int8(cbyte), nil
     }
 
-    return nil, nil
+    return nil, &SyntaxError{ fmt.Sprintf("invalid control byte 0x%02x", cbyte), d.tokOff }
 }
 
-// Method decodes the item using the reflect types
-func (d *Decoder) decode(rv reflect.Value) error {
-
-    //Got pointer so deref it
-    kind := rv.Kind()
-    if kind == reflect.Ptr {
-        return d.decode(rv.Elem())
-    }
-
-    //Get token
+// Method reads the token of a value nested in an array or
+// map, where running out of data is unexpected
+func (d *Decoder) nextToken() (Token, error) {
     tok, err := d.Token()
-    if err != nil {
-        return err
+    if err == io.EOF {
+        err = io.ErrUnexpectedEOF
     }
 
-    //Switch based on token
-    switch v := tok.(type) {
+    return tok, err
+}
 
-        //Signed Integer
-        case int64:
-            rv.SetInt(v)
-        case int32:
-            rv.SetInt(int64(v))
-        case int16:
-            rv.SetInt(int64(v))
-        case int8:
-            rv.SetInt(int64(v))
-        case int:
-            rv.SetInt(int64(v))
+// Method returns the Unmarshaler for rv if it has one,
+// allocating nil pointers
+func unmarshaler(rv reflect.Value) Unmarshaler {
+    if rv.Kind() == reflect.Ptr && rv.Type().Implements(unmarshalerType) {
+        if rv.IsNil() {
+            rv.Set(reflect.New(rv.Type().Elem()))
+        }
 
-        //Unsigned Integer
-        case uint64:
-            rv.SetUint(v)
-        case uint32:
-            d.k = Uint32
-            rv.SetUint(uint64(v))
-        case uint16:
-            rv.SetUint(uint64(v))
-        case uint8:
-            rv.SetUint(uint64(v))
-        case uint:
-            rv.SetUint(uint64(v))
+        return rv.Interface().(Unmarshaler)
+    } else if rv.CanAddr() && reflect.PtrTo(rv.Type()).Implements(unmarshalerType) {
+        return rv.Addr().Interface().(Unmarshaler)
     }
 
     return nil
 }
 
-// Method decodes an interface
-func (d *Decoder) Decode(v interface{}) error {
-    return d.decode(reflect.ValueOf(v))
+// Method captures the encoded bytes of the next value. A capture
+// already in progress keeps recording them as well.
+func (d *Decoder) readRaw() ([]byte, error) {
+    recording, outer := d.recording, d.raw
+    d.recording, d.raw = true, nil
+    err := d.Skip()
+    raw := d.raw
+    d.recording, d.raw = recording, outer
+    if recording {
+        d.raw = append(d.raw, raw...)
+    }
+
+    return raw, err
 }
 
-// Gets current kind
+// Method hands the encoded bytes of the next value to u
+func (d *Decoder) decodeUnmarshaler(u Unmarshaler) error {
+    raw, err := d.readRaw()
+    if err != nil {
+        return err
+    }
+
+    return u.MsgPackUnmarshaler(raw)
+}
+
+// Method returns the generated decoder for rv if it has one and the
+// decoder's options leave it usable, allocating nil pointers.
+// Generated decoders ignore unknown keys and keep the last of
+// repeated ones.
+func (d *Decoder) msgUnmarshaler(rv reflect.Value) MsgUnmarshaler {
+    if d.disallowUnknown || d.dupPolicy != DuplicateKeysLastWins {
+        return nil
+    }
+
+    if rv.Kind() == reflect.Ptr && rv.Type().Implements(msgUnmarshalerType) {
+        //nil is left to decode, which sets the pointer to nil
+        if k, err := d.PeekKind(); err != nil || k == Nil {
+            return nil
+        } else if rv.IsNil() {
+            rv.Set(reflect.New(rv.Type().Elem()))
+        }
+
+        return rv.Interface().(MsgUnmarshaler)
+    } else if rv.CanAddr() && reflect.PtrTo(rv.Type()).Implements(msgUnmarshalerType) {
+        return rv.Addr().Interface().(MsgUnmarshaler)
+    }
+
+    return nil
+}
+
+// Method decodes the next value with a generated decoder. Input
+// already in memory is decoded in place, anything else is read
+// into a buffer first so limits apply to it.
+func (d *Decoder) decodeMsg(u MsgUnmarshaler) error {
+    start := d.off
+    var in, rest []byte
+    var err error
+    if d.eof && d.limits == (DecoderLimits{}) {
+        if d.r == d.w {
+            return io.EOF
+        }
+
+        in = d.buf[d.r:d.w]
+        if rest, err = u.UnmarshalMsg(in); err == nil {
+            d.consume(len(in) - len(rest))
+            return nil
+        }
+    } else if in, err = d.readRaw(); err != nil {
+        return err
+    } else if rest, err = u.UnmarshalMsg(in); err == nil {
+        return nil
+    }
+
+    return d.msgError(err, reflect.TypeOf(u).Elem(), start + int64(len(in) - len(rest)))
+}
+
+// Method places an error from a generated decoder in the input.
+// base is the offset of the value that failed. Type errors get the
+// path and type reflection would have reported.
+func (d *Decoder) msgError(err error, t reflect.Type, base int64) error {
+    switch e := err.(type) {
+        case *SyntaxError:
+            e.Offset += base
+
+        case *UnmarshalTypeError:
+            e.Offset += base
+            if e.Field == "" {
+                e.Type = t
+                e.setPath(d.path)
+                return e
+            }
+
+            path := append([]string{}, d.path...)
+            if len(path) == 0 {
+                path = append(path, t.Name())
+            }
+
+            if e.Field[0] != '[' {
+                e.Field = "." + e.Field
+            }
+
+            e.setPath(append(path, e.Field))
+    }
+
+    return err
+}
+
+// Method decodes a nested item using the reflect types
+func (d *Decoder) decode(rv reflect.Value) error {
+    if u := unmarshaler(rv); u != nil {
+        err := d.decodeUnmarshaler(u)
+        if err == io.EOF {
+            err = io.ErrUnexpectedEOF
+        }
+
+        return err
+    } else if u := d.msgUnmarshaler(rv); u != nil {
+        err := d.decodeMsg(u)
+        if err == io.EOF {
+            err = io.ErrUnexpectedEOF
+        }
+
+        return err
+    }
+
+    //Get token
+    tok, err := d.nextToken()
+    if err != nil {
+        return err
+    }
+
+    return d.decodeToken(tok, rv)
+}
+
+// Method decodes an already read token into the value
+func (d *Decoder) decodeToken(tok Token, rv reflect.Value) error {
+    if rv.Type() == valueType {
+        val, err := d.tokenValue(tok)
+        if err != nil {
+            return err
+        }
+
+        rv.Set(reflect.ValueOf(val))
+        return nil
+    }
+
+    switch rv.Kind() {
+        //Got pointer so deref it, allocating if needed
+        case reflect.Ptr:
+            if tok == nil {
+                rv.Set(reflect.Zero(rv.Type()))
+                return nil
+            } else if rv.IsNil() {
+                rv.Set(reflect.New(rv.Type().Elem()))
+            }
+
+            return d.decodeToken(tok, rv.Elem())
+
+        //Empty interface gets the natural Go type
+        case reflect.Interface:
+            if rv.NumMethod() == 0 {
+                v, err := d.decodeInterface(tok)
+                if err != nil {
+                    return err
+                }
+
+                if v == nil {
+                    rv.Set(reflect.Zero(rv.Type()))
+                } else {
+                    rv.Set(reflect.ValueOf(v))
+                }
+
+                return nil
+            }
+    }
+
+    //Switch based on token
+    switch v := tok.(type) {
+
+        //Signed Integer
+        case int64:
+            return d.decodeInt(v, rv)
+        case int32:
+            return d.decodeInt(int64(v), rv)
+        case int16:
+            return d.decodeInt(int64(v), rv)
+        case int8:
+            return d.decodeInt(int64(v), rv)
+        case int:
+            return d.decodeInt(int64(v), rv)
+
+        //Unsigned Integer
+        case uint64:
+            return d.decodeUint(v, rv)
+        case uint32:
+            return d.decodeUint(uint64(v), rv)
+        case uint16:
+            return d.decodeUint(uint64(v), rv)
+        case uint8:
+            return d.decodeUint(uint64(v), rv)
+        case uint:
+            return d.decodeUint(uint64(v), rv)
+
+        //Nil
+        case nil:
+            rv.Set(reflect.Zero(rv.Type()))
+
+        //Boolean
+        case bool:
+            if rv.Kind() != reflect.Bool {
+                return d.mismatch(rv)
+            }
+
+            rv.SetBool(v)
+
+        //Float
+        case float32:
+            if rv.Kind() != reflect.Float32 && rv.Kind() != reflect.Float64 {
+                return d.mismatch(rv)
+            }
+
+            rv.SetFloat(float64(v))
+        case float64:
+            if rv.Kind() != reflect.Float32 && rv.Kind() != reflect.Float64 {
+                return d.mismatch(rv)
+            }
+
+            rv.SetFloat(v)
+
+        //String and binary are interchangeable
+        case string:
+            return d.decodeBytes([]byte(v), rv)
+        case []byte:
+            return d.decodeBytes(v, rv)
+
+        //Extensions
+        case Ext:
+            if rv.Type() != reflect.TypeOf(v) {
+                return d.mismatch(rv)
+            }
+
+            rv.Set(reflect.ValueOf(v))
+
+        //Containers
+        case ArrayStart:
+            return d.decodeArray(int(v), rv)
+        case MapStart:
+            if rv.Kind() == reflect.Struct {
+                return d.decodeStruct(int(v), rv)
+            }
+
+            return d.decodeMap(int(v), rv)
+    }
+
+    return nil
+}
+
+// Method returns an error for a token that cannot be stored in rv
+func (d *Decoder) mismatch(rv reflect.Value) error {
+    return d.typeError(d.k.Type().String(), rv)
+}
+
+// Method returns an UnmarshalTypeError for the last token read
+func (d *Decoder) typeError(value string, rv reflect.Value) error {
+    err := &UnmarshalTypeError{ Value: value, Type: rv.Type(), Offset: d.tokOff }
+    err.setPath(d.path)
+    return err
+}
+
+// Method sets Struct and Field from a decode path, whose first
+// element names the root struct if it is not a key or index
+func (e *UnmarshalTypeError) setPath(path []string) {
+    if len(path) > 0 && len(path[0]) > 0 && path[0][0] != '.' && path[0][0] != '[' {
+        e.Struct = path[0]
+        e.Field = strings.TrimPrefix(strings.Join(path[1:], ""), ".")
+    } else {
+        e.Struct = ""
+        e.Field = strings.TrimPrefix(strings.Join(path, ""), ".")
+    }
+}
+
+// Method stores a signed integer into any integer kind that
+// can hold its value
+func (d *Decoder) decodeInt(v int64, rv reflect.Value) error {
+    switch rv.Kind() {
+        case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+            if rv.OverflowInt(v) {
+                return d.overflow(v, rv)
+            }
+
+            rv.SetInt(v)
+        case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+            if v < 0 || rv.OverflowUint(uint64(v)) {
+                return d.overflow(v, rv)
+            }
+
+            rv.SetUint(uint64(v))
+        default:
+            return d.mismatch(rv)
+    }
+
+    return nil
+}
+
+// Method stores an unsigned integer into any integer kind that
+// can hold its value
+func (d *Decoder) decodeUint(v uint64, rv reflect.Value) error {
+    switch rv.Kind() {
+        case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+            if v > math.MaxInt64 || rv.OverflowInt(int64(v)) {
+                return d.overflow(v, rv)
+            }
+
+            rv.SetInt(int64(v))
+        case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+            if rv.OverflowUint(v) {
+                return d.overflow(v, rv)
+            }
+
+            rv.SetUint(v)
+        default:
+            return d.mismatch(rv)
+    }
+
+    return nil
+}
+
+// Method returns an error for an integer too large for rv
+func (d *Decoder) overflow(v interface{}, rv reflect.Value) error {
+    return d.typeError(fmt.Sprintf("%v %v", d.k.Type(), v), rv)
+}
+
+// Method decodes str or bin data into a string or byte slice
+func (d *Decoder) decodeBytes(b []byte, rv reflect.Value) error {
+    switch {
+        case rv.Kind() == reflect.String:
+            rv.SetString(string(b))
+        case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8:
+            rv.SetBytes(b)
+        default:
+            return d.mismatch(rv)
+    }
+
+    return nil
+}
+
+// Method enters a nested array or map
+func (d *Decoder) enter() error {
+    d.depth++
+    return d.checkLimit("MaxDepth", int64(d.depth), int64(d.limits.MaxDepth))
+}
+
+// Method leaves a nested array or map
+func (d *Decoder) leave() {
+    d.depth--
+}
+
+// Method decodes l array elements into a slice or array
+func (d *Decoder) decodeArray(l int, rv reflect.Value) error {
+    if err := d.enter(); err != nil {
+        return err
+    }
+    defer d.leave()
+
+    switch rv.Kind() {
+        case reflect.Slice:
+            if rv.IsNil() || rv.Cap() < l {
+                rv.Set(reflect.MakeSlice(rv.Type(), l, l))
+            } else {
+                rv.SetLen(l)
+            }
+
+        case reflect.Array:
+            //Elements past the end of the array are dropped
+            rv.Set(reflect.Zero(rv.Type()))
+
+        default:
+            return d.mismatch(rv)
+    }
+
+    for i:=0; i<l; i++ {
+        d.push(fmt.Sprintf("[%d]", i))
+        var err error
+        if i < rv.Len() {
+            err = d.decode(rv.Index(i))
+        } else {
+            err = d.discard()
+        }
+        d.pop()
+
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// Method decodes l key/value pairs into a map
+func (d *Decoder) decodeMap(l int, rv reflect.Value) error {
+    if rv.Kind() != reflect.Map {
+        return d.mismatch(rv)
+    } else if err := d.enter(); err != nil {
+        return err
+    }
+    defer d.leave()
+
+    if rv.IsNil() {
+        rv.Set(reflect.MakeMap(rv.Type()))
+    }
+
+    seen := make(map[interface{}]bool, l)
+    kt, vt := rv.Type().Key(), rv.Type().Elem()
+    for i:=0; i<l; i++ {
+        key := reflect.New(kt).Elem()
+        var k Kind
+        off := d.off
+        if kt.Kind() == reflect.Interface {
+            var err error
+            if k, err = d.PeekKind(); err != nil {
+                return err
+            }
+        }
+
+        if err := d.decode(key); err != nil {
+            return err
+        }
+
+        //Interface keys must be hashable. bin becomes a string as in
+        //Value.Interface, array, map and ext keys cannot be stored.
+        if kt.Kind() == reflect.Interface && !key.IsNil() {
+            if b, ok := key.Interface().([]byte); ok {
+                key.Set(reflect.ValueOf(string(b)))
+            } else if !key.Elem().Type().Comparable() {
+                terr := d.typeError(k.Type().String() + " key", key).(*UnmarshalTypeError)
+                terr.Offset = off
+                return terr
+            }
+        }
+
+        //Check for duplicates
+        name := fmt.Sprint(key.Interface())
+        dup := false
+        if kt.Comparable() {
+            dup = seen[key.Interface()]
+            seen[key.Interface()] = true
+        }
+
+        err := d.decodeEntry(name, dup, func() error {
+            val := reflect.New(vt).Elem()
+            if err := d.decode(val); err != nil {
+                return err
+            }
+
+            rv.SetMapIndex(key, val)
+            return nil
+        })
+
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// Method decodes l key/value pairs into the public fields of a struct
+func (d *Decoder) decodeStruct(l int, rv reflect.Value) error {
+    if err := d.enter(); err != nil {
+        return err
+    }
+    defer d.leave()
+
+    fields := cachedStructPlan(rv.Type()).byKey
+    if len(d.path) == 0 {
+        d.push(rv.Type().Name())
+        defer d.pop()
+    }
+
+    seen := make(map[string]bool, l)
+    for i:=0; i<l; i++ {
+        //Keys are matched by their string representation
+        tok, err := d.nextToken()
+        if err != nil {
+            return err
+        }
+
+        var name string
+        container := false
+        switch k := tok.(type) {
+            case string:
+                name = k
+            case []byte:
+                name = string(k)
+
+            //Array and map keys match no field, so their contents are
+            //skipped along with the value
+            case ArrayStart, MapStart:
+                name, container = d.k.Type().String(), true
+                if err := skipContents(d, tok); err != nil {
+                    return err
+                }
+
+            default:
+                name = fmt.Sprint(k)
+        }
+
+        idx, ok := fields[name]
+        if !ok || container {
+            if d.disallowUnknown {
+                return &UnknownFieldError{ Key: name, Path: d.pathString() }
+            }
+
+            if err := d.discard(); err != nil {
+                return err
+            }
+
+            continue
+        }
+
+        dup := seen[name]
+        seen[name] = true
+
+        err = d.decodeEntry(name, dup, func() error {
+            return d.decode(rv.Field(idx))
+        })
+
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// Method applies the duplicate key policy to a map entry. fn
+// decodes the value and is only called when it should be kept.
+func (d *Decoder) decodeEntry(key string, dup bool, fn func() error) error {
+    if dup {
+        switch d.dupPolicy {
+            case DuplicateKeysError:
+                return &DuplicateKeyError{ Key: key, Path: d.pathString() }
+
+            case DuplicateKeysFirstWins:
+                return d.discard()
+        }
+    }
+
+    d.push("." + key)
+    defer d.pop()
+    return fn()
+}
+
+// Method skips a nested value, where running out of data
+// is unexpected
+func (d *Decoder) discard() error {
+    err := d.Skip()
+    if err == io.EOF {
+        err = io.ErrUnexpectedEOF
+    }
+
+    return err
+}
+
+// Method converts a token into its natural Go type. Arrays
+// become []interface{} and maps map[interface{}]interface{}.
+func (d *Decoder) decodeInterface(tok Token) (interface{}, error) {
+    switch v := tok.(type) {
+        case ArrayStart:
+            if err := d.enter(); err != nil {
+                return nil, err
+            }
+            defer d.leave()
+
+            arr := make([]interface{}, int(v))
+            for i:=range arr {
+                d.push(fmt.Sprintf("[%d]", i))
+                err := d.decode(reflect.ValueOf(&arr[i]).Elem())
+                d.pop()
+
+                if err != nil {
+                    return nil, err
+                }
+            }
+
+            return arr, nil
+
+        case MapStart:
+            m := make(map[interface{}]interface{}, int(v))
+            err := d.decodeMap(int(v), reflect.ValueOf(&m).Elem())
+            return m, err
+    }
+
+    return tok, nil
+}
+
+// Method pushes a path element onto the path stack
+func (d *Decoder) push(p string) {
+    d.path = append(d.path, p)
+}
+
+// Method pops the last element of the path stack
+func (d *Decoder) pop() {
+    d.path = d.path[:len(d.path)-1]
+}
+
+// Method returns the current path, e.g. Order.items[3].price
+func (d *Decoder) pathString() string {
+    var sb bytes.Buffer
+    for _, p := range d.path {
+        sb.WriteString(p)
+    }
+
+    return string(bytes.TrimPrefix(sb.Bytes(), []byte(".")))
+}
+
+// Method decodes an interface
+func (d *Decoder) Decode(v interface{}) error {
+    rv := reflect.ValueOf(v)
+    if rv.Kind() != reflect.Ptr || rv.IsNil() {
+        return fmt.Errorf("msgpack: Decode requires a non-nil pointer, got %T", v)
+    }
+
+    d.path = d.path[:0]
+    d.depth = 0
+    if u := unmarshaler(rv.Elem()); u != nil {
+        return d.decodeUnmarshaler(u)
+    } else if u := d.msgUnmarshaler(rv.Elem()); u != nil {
+        return d.decodeMsg(u)
+    }
+
+    tok, err := d.Token()
+    if err != nil {
+        return err
+    }
+
+    return d.decodeToken(tok, rv.Elem())
+}
+
+// Gets current kind
 func (d *Decoder) Kind() Kind {
     return d.k
 }
 
+// Method returns the kind of the next value without consuming
+// it. Returns io.EOF when there is no next value.
+func (d *Decoder) PeekKind() (Kind, error) {
+    cbyte, err := d.peekByte()
+    if err != nil {
+        return 0, err
+    }
+
+    return kindOf(cbyte), nil
+}
+
+// Method returns the next byte without consuming it
+func (d *Decoder) peekByte() (byte, error) {
+    if d.r == d.w {
+        if err := d.fill(); err != nil {
+            return 0, err
+        }
+    }
+
+    return d.buf[d.r], nil
+}
+
+// Method reports whether another value follows. A clean end of
+// input between values is not an error and returns false, as do
+// read errors, which the next Decode or Token call reports.
+func (d *Decoder) More() bool {
+    _, err := d.PeekKind()
+    return err == nil
+}
+
+// Method returns the number of input bytes consumed so far,
+// i.e. the offset of the next value
+func (d *Decoder) InputOffset() int64 {
+    return d.off
+}
+
+/***********************/
+/** Start Typed Reads **/
+/***********************/
+
+// The Read methods decode one value of an expected type without
+// reflection. When the next value has another type they return an
+// *UnmarshalTypeError and leave it unread. Integers too large for
+// the result are consumed before the error is returned.
+
+var (
+    int64Type = reflect.TypeOf(int64(0))
+    uint64Type = reflect.TypeOf(uint64(0))
+    float64Type = reflect.TypeOf(float64(0))
+    boolType = reflect.TypeOf(false)
+    stringType = reflect.TypeOf("")
+    bytesType = reflect.TypeOf([]byte(nil))
+    arrayType = reflect.TypeOf([]interface{}(nil))
+    mapType = reflect.TypeOf(map[interface{}]interface{}(nil))
+)
+
+// Method checks the next value belongs to one of the types
+// without consuming it. Returns its control byte.
+func (d *Decoder) expect(rt reflect.Type, types ...Type) (byte, error) {
+    cbyte, err := d.peekByte()
+    if err != nil {
+        return 0, err
+    }
+
+    k := kindOf(cbyte)
+    for _, t := range types {
+        if k.Type() == t {
+            return cbyte, nil
+        }
+    }
+
+    d.k, d.tokOff = k, d.off
+    return 0, d.typeError(k.Type().String(), reflect.New(rt).Elem())
+}
+
+// Method reads the header of the next value, checking its type.
+// Returns the control byte and payload length.
+func (d *Decoder) readTyped(rt reflect.Type, types ...Type) (byte, int, error) {
+    cbyte, err := d.expect(rt, types...)
+    if err != nil {
+        return 0, 0, err
+    }
+
+    children, data, err := d.readHeader()
+    if d.k.Type() == MapType {
+        children /= 2
+    }
+
+    return cbyte, data + children, err
+}
+
+// Method reads an integer of any width. neg reports whether
+// v holds a negative int64.
+func (d *Decoder) readInteger(rt reflect.Type) (v uint64, neg bool, err error) {
+    cbyte, size, err := d.readTyped(rt, IntType, UintType)
+    if err != nil {
+        return 0, false, err
+    }
+
+    switch d.k {
+        case FixUint:
+            return uint64(cbyte), false, nil
+        case FixInt:
+            return uint64(int8(cbyte)), true, nil
+    }
+
+    buf := d.scratch[:size]
+    if err := d.read(buf); err != nil {
+        return 0, false, err
+    }
+
+    for _, b := range buf {
+        v = v << 8 | uint64(b)
+    }
+
+    //Sign extend signed values
+    if d.k.Type() == IntType {
+        shift := 64 - 8*uint(size)
+        s := int64(v << shift) >> shift
+        return uint64(s), s < 0, nil
+    }
+
+    return v, false, nil
+}
+
+// Method reads an integer of any width that fits an int64
+func (d *Decoder) ReadInt64() (int64, error) {
+    v, neg, err := d.readInteger(int64Type)
+    if err != nil {
+        return 0, err
+    } else if !neg && v > math.MaxInt64 {
+        return 0, d.overflow(v, reflect.New(int64Type).Elem())
+    }
+
+    return int64(v), nil
+}
+
+// Method reads a non negative integer of any width
+func (d *Decoder) ReadUint64() (uint64, error) {
+    v, neg, err := d.readInteger(uint64Type)
+    if err != nil {
+        return 0, err
+    } else if neg {
+        return 0, d.overflow(int64(v), reflect.New(uint64Type).Elem())
+    }
+
+    return v, nil
+}
+
+// Method reads a float32 or float64
+func (d *Decoder) ReadFloat64() (float64, error) {
+    _, size, err := d.readTyped(float64Type, FloatType)
+    if err != nil {
+        return 0, err
+    }
+
+    buf := d.scratch[:size]
+    if err := d.read(buf); err != nil {
+        return 0, err
+    } else if size == 4 {
+        return float64(math.Float32frombits(binary.BigEndian.Uint32(buf))), nil
+    }
+
+    return math.Float64frombits(binary.BigEndian.Uint64(buf)), nil
+}
+
+// Method reads a boolean
+func (d *Decoder) ReadBool() (bool, error) {
+    if _, _, err := d.readTyped(boolType, BoolType); err != nil {
+        return false, err
+    }
+
+    return d.k == True, nil
+}
+
+// Method reads a nil
+func (d *Decoder) ReadNil() error {
+    _, _, err := d.readTyped(reflect.TypeOf((*interface{})(nil)).Elem(), NilType)
+    return err
+}
+
+// Method reads a str
+func (d *Decoder) ReadString() (string, error) {
+    _, size, err := d.readTyped(stringType, StringType)
+    if err != nil {
+        return "", err
+    }
+
+    b, err := d.readData(size)
+    return string(b), err
+}
+
+// Method reads a bin
+func (d *Decoder) ReadBytes() ([]byte, error) {
+    _, size, err := d.readTyped(bytesType, BinType)
+    if err != nil {
+        return nil, err
+    }
+
+    return d.readData(size)
+}
+
+// Method reads an array header and returns the number of
+// elements, which are then read one by one
+func (d *Decoder) ReadArrayHeader() (int, error) {
+    _, n, err := d.readTyped(arrayType, ArrayType)
+    return n, err
+}
+
+// Method reads a map header and returns the number of key/value
+// pairs, which are then read one by one
+func (d *Decoder) ReadMapHeader() (int, error) {
+    _, n, err := d.readTyped(mapType, MapType)
+    return n, err
+}
+
+/*********************/
+/** End Typed Reads **/
+/*********************/
+
 /*****************/
 /** End Decoder **/
 /*****************/
 
 // Function Unmarshals the data
-func Unmarshal(d []byte, v interface{}) error {
-    dec := NewDecoder(bytes.NewReader(d))
+func Unmarshal(d []byte, v interface{}, opts ...DecoderOption) error {
+    dec := newBytesDecoder(d, opts...)
     if err := dec.Decode(v); err != nil {
         return err
     }
@@ -0,0 +1,226 @@
+package msgpack
+import (
+    "strconv"
+    "strings"
+    "bytes"
+    "math"
+    "fmt"
+)
+
+// What happened at a path between two documents
+type DiffOp int
+
+const (
+    DiffAdded DiffOp = iota
+    DiffRemoved
+    DiffChanged
+)
+
+func (op DiffOp) String() string {
+    switch op {
+        case DiffAdded:
+            return "added"
+        case DiffRemoved:
+            return "removed"
+        case DiffChanged:
+            return "changed"
+    }
+
+    return "invalid"
+}
+
+// One difference between two documents. Old is the zero Value
+// for additions and New for removals.
+type Difference struct {
+    Path string   // e.g. items[3].price, empty for the document itself
+    Op DiffOp
+    Old Value
+    New Value
+}
+
+func (d Difference) String() string {
+    path := d.Path
+    if path == "" {
+        path = "<root>"
+    }
+
+    //Strings are quoted so they stand apart from other types
+    before, after := strings.Builder{}, strings.Builder{}
+    d.Old.format(&before)
+    d.New.format(&after)
+    switch d.Op {
+        case DiffAdded:
+            return fmt.Sprintf("+ %s: %s", path, after.String())
+        case DiffRemoved:
+            return fmt.Sprintf("- %s: %s", path, before.String())
+    }
+
+    return fmt.Sprintf("~ %s: %s -> %s", path, before.String(), after.String())
+}
+
+// Options for comparing documents
+type DiffOptions struct {
+    Strict bool   // Numbers must have the same format and maps the same key order
+}
+
+// Function returns the differences between the first documents of a
+// and b, ignoring map key order and integer widths. Fails when either
+// document does not decode.
+func Diff(a, b []byte) ([]Difference, error) {
+    return DiffOptions{}.Diff(a, b)
+}
+
+// Method returns the differences between the first documents of a and b
+func (o DiffOptions) Diff(a, b []byte) ([]Difference, error) {
+    var va, vb Value
+    if err := newBytesDecoder(a).Decode(&va); err != nil {
+        return nil, err
+    } else if err := newBytesDecoder(b).Decode(&vb); err != nil {
+        return nil, err
+    }
+
+    return o.DiffValues(va, vb), nil
+}
+
+// Method returns the differences between two values
+func (o DiffOptions) DiffValues(a, b Value) []Difference {
+    var diffs []Difference
+    o.diff(&diffs, "", a, b)
+    return diffs
+}
+
+// Method appends the differences between a and b at path
+func (o DiffOptions) diff(diffs *[]Difference, path string, a, b Value) {
+    switch {
+        case a.t == ArrayType && b.t == ArrayType:
+            for i := 0; i < len(a.arr) || i < len(b.arr); i++ {
+                p := path + "[" + strconv.Itoa(i) + "]"
+                switch {
+                    case i >= len(b.arr):
+                        *diffs = append(*diffs, Difference{ p, DiffRemoved, a.arr[i], Value{} })
+                    case i >= len(a.arr):
+                        *diffs = append(*diffs, Difference{ p, DiffAdded, Value{}, b.arr[i] })
+                    default:
+                        o.diff(diffs, p, a.arr[i], b.arr[i])
+                }
+            }
+
+        case a.t == MapType && b.t == MapType:
+            o.diffMaps(diffs, path, a, b)
+
+        case !o.equal(a, b):
+            *diffs = append(*diffs, Difference{ path, DiffChanged, a, b })
+    }
+}
+
+// Method appends the differences between the entries of two maps,
+// matching entries by key
+func (o DiffOptions) diffMaps(diffs *[]Difference, path string, a, b Value) {
+    bidx := make(map[string]int, len(b.items))
+    for i, item := range b.items {
+        id := o.keyID(item.Key)
+        if _, dup := bidx[id]; !dup {
+            bidx[id] = i
+        }
+    }
+
+    //Keys of a in a's order, then keys only b has
+    seen := make([]bool, len(b.items))
+    reordered, changed := false, false
+    for i, item := range a.items {
+        p := keyPath(path, item.Key)
+        j, ok := bidx[o.keyID(item.Key)]
+        if !ok || seen[j] {
+            *diffs = append(*diffs, Difference{ p, DiffRemoved, item.Value, Value{} })
+            changed = true
+            continue
+        }
+
+        seen[j] = true
+        reordered = reordered || i != j
+        o.diff(diffs, p, item.Value, b.items[j].Value)
+    }
+
+    for j, item := range b.items {
+        if !seen[j] {
+            *diffs = append(*diffs, Difference{ keyPath(path, item.Key), DiffAdded, Value{}, item.Value })
+            changed = true
+        }
+    }
+
+    //Strict maps keep their key order
+    if o.Strict && reordered && !changed {
+        *diffs = append(*diffs, Difference{ path, DiffChanged, a, b })
+    }
+}
+
+// Function returns the path of a map entry: .key for str keys and
+// [key] for others
+func keyPath(path string, key Value) string {
+    if key.t == StringType {
+        if path == "" {
+            return key.s
+        }
+
+        return path + "." + key.s
+    }
+
+    return path + "[" + key.String() + "]"
+}
+
+// Method returns a string identifying a map key, equal for keys
+// that compare equal
+func (o DiffOptions) keyID(key Value) string {
+    t := key.t
+    if !o.Strict && t == UintType && key.u <= math.MaxInt64 {
+        t = IntType
+    }
+
+    if o.Strict {
+        return fmt.Sprintf("%v:%v", key.k, key)
+    }
+
+    return fmt.Sprintf("%v:%v", t, key)
+}
+
+// Method reports whether two values are equal. Unless strict,
+// integers compare by value whatever their format, floats by value
+// whatever their width and maps whatever their key order.
+func (o DiffOptions) equal(a, b Value) bool {
+    if o.Strict && (a.t == IntType || a.t == UintType || a.t == FloatType) && a.k != b.k {
+        return false
+    }
+
+    switch {
+        case (a.t == IntType || a.t == UintType) && (b.t == IntType || b.t == UintType):
+            if a.t == b.t {
+                return a.i == b.i && a.u == b.u
+            }
+
+            //Only non negative ints can equal a uint
+            if a.t == IntType {
+                return a.i >= 0 && uint64(a.i) == b.u
+            }
+
+            return b.i >= 0 && uint64(b.i) == a.u
+
+        case a.t != b.t:
+            return false
+
+        case a.t == FloatType:
+            return a.f == b.f || (math.IsNaN(a.f) && math.IsNaN(b.f))
+        case a.t == StringType:
+            return a.s == b.s
+        case a.t == BinType:
+            return bytes.Equal(a.b, b.b)
+        case a.t == ExtType:
+            return a.ext == b.ext && bytes.Equal(a.b, b.b)
+        case a.t == ArrayType, a.t == MapType:
+            var diffs []Difference
+            o.diff(&diffs, "", a, b)
+            return len(diffs) == 0
+    }
+
+    //nil, bool and the zero Value
+    return a.k == b.k
+}
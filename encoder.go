@@ -5,7 +5,8 @@ import (
     "strings"
     "unsafe"
     "bytes"
-    "log"
+    "sort"
+    "math"
     "fmt"
     "io"
 )
@@ -16,6 +17,9 @@ type Marshaler interface {
 
 type Encoder struct {
     wtr io.Writer
+    canonical bool
+    typeWidth bool
+    buf []byte    // Reused by generated encoders
 }
 
 // Convineince function to write out a byte onto a writer
@@ -38,6 +42,38 @@ func reverseByte(b []byte) {
 
 var errFixNumOutOfBounds = fmt.Errorf("Numerical value out of bounds for fixint")
 
+// Error returned when encoding a Go type msgpack has no
+// representation for (e.g. chan, func or complex)
+type UnsupportedTypeError struct {
+    Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+    return "msgpack: unsupported type: " + e.Type.String()
+}
+
+// Error returned when encoding a value the encoder cannot
+// represent, such as an invalid integer bit size
+type UnsupportedValueError struct {
+    Value reflect.Value
+    Str string
+}
+
+func (e *UnsupportedValueError) Error() string {
+    return "msgpack: unsupported value: " + e.Str
+}
+
+// Error returned when a str, bin, array or map is larger
+// than the 4294967295 elements a 32 bit length can hold
+type SizeLimitError struct {
+    Kind string  // "str", "bin", "ext", "array" or "map"
+    Size int
+}
+
+func (e *SizeLimitError) Error() string {
+    return fmt.Sprintf("msgpack: %s of length %d exceeds the limit of %d", e.Kind, e.Size, uint32(math.MaxUint32))
+}
+
 // Function takes in an integer and translates the number to a fixnum format
 // Fixnum format consists of an 8bit (1byte) integer with positive numbers:
 // 0XXXXXXX where MSB is the control bit set to 0 and the next 7bits are the
@@ -47,43 +83,44 @@ func encodeFixNumInt(wtr io.Writer, val int8) error {
     // For positive integers we can store 0XXXXXXX
     // where 0 is postive int indicator and XXXXXXX is
     // actual number
-    if val <= 0x7F && val >= 0 {
-        nval := byte(0x00 | (uint8(val) & 0x7F))
-        if bwtr, ok := wtr.(io.ByteWriter); ok {
-            bwtr.WriteByte(nval)
-        } else {
-            wtr.Write([]byte{ nval })
-        }
-
-        return nil
-
     // Negative number representations are 111YYYYY
-    // Control bits are 111 and YYYYY is the value of
-    // the negative integer
-    // We convert the negative integer two's compliment
-    // to postive to ensure it fits in 5 bits (YYYYY)
-    } else if val < 0 && ((uint8(val) ^ 0xFF)+1) < 0x1F {
-        // Ones compliment the number
-        //      111b       YYYYY (5 bit)
-        nval := 0xE0 | byte((uint8(val) ^ 0xFF)+1)
-        if bwtr, ok := wtr.(io.ByteWriter); ok {
-            bwtr.WriteByte(nval)
-        } else {
-            wtr.Write([]byte{ nval })
-        }
-
-        return nil
+    // where the whole byte is the two's compliment of
+    // the value, covering -32 to -1
+    if val >= -32 {
+        return writeByte(wtr, byte(val))
     }
 
     return errFixNumOutOfBounds
 }
 
+// Function checks the bit size passed to EncodeInt and
+// EncodeUint is one msgpack supports
+func checkIntSize(bsize int) error {
+    switch bsize {
+        case 8, 16, 32, 64:
+            return nil
+    }
+
+    return &UnsupportedValueError{ reflect.ValueOf(bsize), fmt.Sprintf("integer bit size %d", bsize) }
+}
+
+// Function returns the error for a value too large for its bit size
+func intOverflow(val interface{}, bsize int) error {
+    return &UnsupportedValueError{ reflect.ValueOf(val), fmt.Sprintf("%v overflows %d bit integer", val, bsize) }
+}
+
 // Function encodes the integer based on size
 func EncodeInt(wtr io.Writer, val int64, bsize int) error {
+    if err := checkIntSize(bsize); err != nil {
+        return err
+    } else if bsize < 64 && (val < -1<<(bsize-1) || val >= 1<<(bsize-1)) {
+        return intOverflow(val, bsize)
+    }
+
     bsize /= 8
 
     //Check if we do FixNum int encoding
-    if (val <= 0x7f && val >= 0) || (val < 0 && ((val ^ 0xff)+1) < 0x1f) {
+    if val <= 0x7f && val >= -32 {
         return encodeFixNumInt(wtr, int8(val))
     }
 
@@ -105,7 +142,7 @@ func EncodeInt(wtr io.Writer, val int64, bsize int) error {
     } else if bsize == 4 {
         ctlbyte = 0xd2
         bval = (*[4]byte)(unsafe.Pointer(&val))[:]
-    } else if bsize == 8 {
+    } else {
         ctlbyte = 0xd3
         bval = (*[8]byte)(unsafe.Pointer(&val))[:]
     }
@@ -126,6 +163,12 @@ func EncodeInt(wtr io.Writer, val int64, bsize int) error {
 
 // Function encodes the unsigned integer based on size
 func EncodeUint(wtr io.Writer, val uint64, bsize int) error {
+    if err := checkIntSize(bsize); err != nil {
+        return err
+    } else if bsize < 64 && val >= 1<<bsize {
+        return intOverflow(val, bsize)
+    }
+
     bsize /= 8
 
     //Check if we do FixNum int encoding
@@ -151,7 +194,7 @@ func EncodeUint(wtr io.Writer, val uint64, bsize int) error {
     } else if bsize == 4 {
         ctlbyte = 0xce
         bval = (*[4]byte)(unsafe.Pointer(&val))[:]
-    } else if bsize == 8 {
+    } else {
         ctlbyte = 0xcf
         bval = (*[8]byte)(unsafe.Pointer(&val))[:]
     }
@@ -180,26 +223,13 @@ func EncodeBool(wtr io.Writer, val bool) error {
     }
 
     //Write out
-    if bwtr, ok := wtr.(io.ByteWriter); ok {
-        bwtr.WriteByte(bval)
-    } else {
-        wtr.Write([]byte{ bval })
-    }
-
-    return nil
+    return writeByte(wtr, bval)
 }
 
-// Function encodes the string into msgpack format
-// The first few bytes are a control byte + length
-// definition of the string. Strings are not NULL
-// terminated.
-// | 101XXXXX | data - [fixstr] For data that is <=31 bytes long
-// | 0xd9 | YYYYYYYY | data - [str8] For data with lengths that are 255 or less
-// | 0xda | ZZZZZZZZ | ZZZZZZZZ | data - [str16] For data with lengths that are 65535 or less
-// | 0xdb | AAAAAAAA * 4 | data - [str32] For data with lengths that are 4294967295 or less
-func EncodeString(wtr io.Writer, s string) error {
+// Function writes the control byte and length of a string
+// | 101XXXXX | [fixstr] | 0xd9 | [str8] | 0xda | [str16] | 0xdb | [str32]
+func writeStrHeader(wtr io.Writer, l int) error {
     //Write control byte
-    l := len(s)
     switch {
         case l<=31:
             var err error
@@ -257,7 +287,23 @@ func EncodeString(wtr io.Writer, s string) error {
             }
 
         default:
-            panic("String larger than 4 gigs!")
+            return &SizeLimitError{ "str", l }
+    }
+
+    return nil
+}
+
+// Function encodes the string into msgpack format
+// The first few bytes are a control byte + length
+// definition of the string. Strings are not NULL
+// terminated.
+// | 101XXXXX | data - [fixstr] For data that is <=31 bytes long
+// | 0xd9 | YYYYYYYY | data - [str8] For data with lengths that are 255 or less
+// | 0xda | ZZZZZZZZ | ZZZZZZZZ | data - [str16] For data with lengths that are 65535 or less
+// | 0xdb | AAAAAAAA * 4 | data - [str32] For data with lengths that are 4294967295 or less
+func EncodeString(wtr io.Writer, s string) error {
+    if err := writeStrHeader(wtr, len(s)); err != nil {
+        return err
     }
 
     //Write out the string
@@ -265,13 +311,9 @@ func EncodeString(wtr io.Writer, s string) error {
     return err
 }
 
-// Function encodes a byte array to a binary msgpack type
-// bin format has three control bytes we can use:
-// | 0xc4 | XXXXXXXX | data - 255 length binary data
-// | 0xc5 | XXXXXXXX * 2 | data - 65535 length binary data
-// | 0xc6 | XXXXXXXX * 4 | data - 4294967295 length binary data
-func EncodeBin(wtr io.Writer, b []byte) error {
-    l := len(b)
+// Function writes the control byte and length of binary data
+// | 0xc4 | [bin8] | 0xc5 | [bin16] | 0xc6 | [bin32]
+func writeBinHeader(wtr io.Writer, l int) error {
     switch {
         case l<=255:
             //Control byte
@@ -315,7 +357,20 @@ func EncodeBin(wtr io.Writer, b []byte) error {
             }
 
         default:
-            panic("Binary larger than 4 gigs!")
+            return &SizeLimitError{ "bin", l }
+    }
+
+    return nil
+}
+
+// Function encodes a byte array to a binary msgpack type
+// bin format has three control bytes we can use:
+// | 0xc4 | XXXXXXXX | data - 255 length binary data
+// | 0xc5 | XXXXXXXX * 2 | data - 65535 length binary data
+// | 0xc6 | XXXXXXXX * 4 | data - 4294967295 length binary data
+func EncodeBin(wtr io.Writer, b []byte) error {
+    if err := writeBinHeader(wtr, len(b)); err != nil {
+        return err
     }
 
     //Write the binary data
@@ -323,13 +378,85 @@ func EncodeBin(wtr io.Writer, b []byte) error {
     return err
 }
 
+// Function writes the control byte, length and type of ext data
+// | 0xd4 - 0xd8 | type | [fixext1 - fixext16] for 1, 2, 4, 8 and 16 bytes
+// | 0xc7 | XXXXXXXX | type | [ext8] up to 255 bytes
+// | 0xc8 | XXXXXXXX * 2 | type | [ext16] up to 65535 bytes
+// | 0xc9 | XXXXXXXX * 4 | type | [ext32] up to 4294967295 bytes
+func writeExtHeader(wtr io.Writer, typ int8, l int) error {
+    switch {
+        case l == 1 || l == 2 || l == 4 || l == 8 || l == 16:
+            //Control byte is 0xd4 + log2(l)
+            ctl := byte(FixExt1)
+            for n := l; n > 1; n >>= 1 {
+                ctl++
+            }
+
+            if err := writeByte(wtr, ctl); err != nil {
+                return err
+            }
+
+        case l <= 255:
+            if err := writeByte(wtr, 0xc7); err != nil {
+                return err
+            }
+
+            if err := writeByte(wtr, byte(l)); err != nil {
+                return err
+            }
+
+        case l <= 65535:
+            if err := writeByte(wtr, 0xc8); err != nil {
+                return err
+            }
+
+            //Big Endian the length
+            var bval []byte
+            tlen := uint16(l)
+            bval = (*[2]byte)(unsafe.Pointer(&tlen))[:]
+            reverseByte(bval)
+            if _, err := wtr.Write(bval); err != nil {
+                return err
+            }
+
+        case l <= 4294967295:
+            if err := writeByte(wtr, 0xc9); err != nil {
+                return err
+            }
+
+            //Big Endian the length
+            var bval []byte
+            tlen := uint32(l)
+            bval = (*[4]byte)(unsafe.Pointer(&tlen))[:]
+            reverseByte(bval)
+            if _, err := wtr.Write(bval); err != nil {
+                return err
+            }
+
+        default:
+            return &SizeLimitError{ "ext", l }
+    }
+
+    return writeByte(wtr, byte(typ))
+}
+
+// Function encodes application defined ext data
+func EncodeExt(wtr io.Writer, typ int8, data []byte) error {
+    if err := writeExtHeader(wtr, typ, len(data)); err != nil {
+        return err
+    }
+
+    _, err := wtr.Write(data)
+    return err
+}
+
 // Encode float 64
 // Float64 is a 9 byte binary (1 byte control + 8 byte float)
 // The data portion must be big endian format
-// | 0xca | XXXXXXXX * 8 |
+// | 0xcb | XXXXXXXX * 8 |
 func EncodeFloat64(wtr io.Writer, f float64) error {
     //Write control byte
-    if err := writeByte(wtr, 0xca); err != nil {
+    if err := writeByte(wtr, 0xcb); err != nil {
         return err
     }
 
@@ -344,9 +471,9 @@ func EncodeFloat64(wtr io.Writer, f float64) error {
 }
 
 // Encode float 32
-// Float64 is a 5 byte binary (1 byte control + 4 byte float)
+// Float32 is a 5 byte binary (1 byte control + 4 byte float)
 // The data portion must be big endian format
-// | 0xcb | XXXXXXXX * 4 |
+// | 0xca | XXXXXXXX * 4 |
 func EncodeFloat32(wtr io.Writer, f float32) error {
     //Write control byte
     if err := writeByte(wtr, 0xca); err != nil {
@@ -367,6 +494,56 @@ func EncodeNil(wtr io.Writer) error {
     return writeByte(wtr, 0xc0)
 }
 
+// Function encodes the integer using the smallest representation
+// that holds its value. Positive values use the unsigned family
+// and negative values the signed family.
+func encodeIntMinimal(wtr io.Writer, val int64) error {
+    switch {
+        case val >= 0:
+            return encodeUintMinimal(wtr, uint64(val))
+        case val >= -32:
+            return encodeFixNumInt(wtr, int8(val))
+        case val >= math.MinInt8:
+            return EncodeInt(wtr, val, 8)
+        case val >= math.MinInt16:
+            return EncodeInt(wtr, val, 16)
+        case val >= math.MinInt32:
+            return EncodeInt(wtr, val, 32)
+    }
+
+    return EncodeInt(wtr, val, 64)
+}
+
+// Function encodes the unsigned integer using the smallest
+// representation that holds its value
+func encodeUintMinimal(wtr io.Writer, val uint64) error {
+    switch {
+        case val <= 0x7f:
+            return encodeFixNumInt(wtr, int8(val))
+        case val <= math.MaxUint8:
+            return EncodeUint(wtr, val, 8)
+        case val <= math.MaxUint16:
+            return EncodeUint(wtr, val, 16)
+        case val <= math.MaxUint32:
+            return EncodeUint(wtr, val, 32)
+    }
+
+    return EncodeUint(wtr, val, 64)
+}
+
+// Function encodes the float in canonical form. Values that
+// survive a float32 round trip are written as float32 and every
+// NaN is written as the same quiet NaN.
+func encodeFloatCanonical(wtr io.Writer, f float64) error {
+    if math.IsNaN(f) {
+        return EncodeFloat32(wtr, float32(math.NaN()))
+    } else if float64(float32(f)) == f {
+        return EncodeFloat32(wtr, float32(f))
+    }
+
+    return EncodeFloat64(wtr, f)
+}
+
 /* Start Encoder **/
 
 // Function creates a new encoder
@@ -374,13 +551,84 @@ func NewEncoder(w io.Writer) *Encoder {
     return &Encoder{ wtr: w }
 }
 
-// Function encodes an array into the writer
-// msgpack defines three array encoding types
-// | 1001XXXX | data - [fixarray] up to 15 elements
-// | 0xdc | YYYYYYYY * 2 | data - [array16] stores up to 65535 elements
-// | 0xdd | ZZZZZZZZ * 4 | data - [array32] stores up to 4294967295 elements
-func (e *Encoder) encodeArray(typ reflect.Type, val reflect.Value) error {
-    l := val.Len()
+// Method makes integers use the width of their Go type
+// (e.g. int64 is always 9 bytes) instead of the smallest
+// representation that holds the value. Ignored in canonical
+// mode.
+func (e *Encoder) SetTypeWidthInts(on bool) {
+    e.typeWidth = on
+}
+
+// Method turns canonical encoding on or off. In canonical mode
+// map and struct keys are sorted by their encoded bytes and
+// integers, lengths and floats use their smallest form, so equal
+// values always encode to identical bytes.
+func (e *Encoder) SetCanonical(on bool) {
+    e.canonical = on
+}
+
+// Function returns an error for a negative header length
+func checkHeaderLen(l int) error {
+    if l < 0 {
+        return &UnsupportedValueError{ reflect.ValueOf(l), fmt.Sprintf("negative length %d", l) }
+    }
+
+    return nil
+}
+
+// Method writes the header of an array of n elements. The
+// elements are then written with Encode one by one, so large
+// arrays can be streamed without building a slice first.
+func (e *Encoder) WriteArrayHeader(n int) error {
+    if err := checkHeaderLen(n); err != nil {
+        return err
+    }
+
+    return e.writeArrayHeader(n)
+}
+
+// Method writes the header of a map of n key/value pairs,
+// followed by 2*n calls to Encode alternating keys and values
+func (e *Encoder) WriteMapHeader(n int) error {
+    if err := checkHeaderLen(n); err != nil {
+        return err
+    }
+
+    return e.writeMapHeader(n)
+}
+
+// Method writes the header of a string of n bytes. The string
+// data is then written to the underlying writer.
+func (e *Encoder) WriteStrHeader(n int) error {
+    if err := checkHeaderLen(n); err != nil {
+        return err
+    }
+
+    return writeStrHeader(e.wtr, n)
+}
+
+// Method writes the header of n bytes of binary data. The data
+// is then written to the underlying writer.
+func (e *Encoder) WriteBinHeader(n int) error {
+    if err := checkHeaderLen(n); err != nil {
+        return err
+    }
+
+    return writeBinHeader(e.wtr, n)
+}
+
+// Method writes the header of n bytes of ext data of the given
+// type. The data is then written to the underlying writer.
+func (e *Encoder) WriteExtHeader(typ int8, n int) error {
+    if err := checkHeaderLen(n); err != nil {
+        return err
+    }
+
+    return writeExtHeader(e.wtr, typ, n)
+}
+
+// Function encodes the header for an Array
+func (e *Encoder) writeArrayHeader(l int) error {
     switch {
         case l <= 15:
             //Control byte + len
@@ -419,7 +667,21 @@ func (e *Encoder) encodeArray(typ reflect.Type, val reflect.Value) error {
             }
 
         default:
-            panic("Array size larger than 4294967295!")
+            return &SizeLimitError{ "array", l }
+    }
+
+    return nil
+}
+
+// Function encodes an array into the writer
+// msgpack defines three array encoding types
+// | 1001XXXX | data - [fixarray] up to 15 elements
+// | 0xdc | YYYYYYYY * 2 | data - [array16] stores up to 65535 elements
+// | 0xdd | ZZZZZZZZ * 4 | data - [array32] stores up to 4294967295 elements
+func (e *Encoder) encodeArray(typ reflect.Type, val reflect.Value) error {
+    l := val.Len()
+    if err := e.writeArrayHeader(l); err != nil {
+        return err
     }
 
     //Actual data
@@ -434,7 +696,7 @@ func (e *Encoder) encodeArray(typ reflect.Type, val reflect.Value) error {
 }
 
 // Function encodes the header for a Map (hash)
-func (e *Encoder) encodeMapHeader(l int) error {
+func (e *Encoder) writeMapHeader(l int) error {
     switch {
         case l <= 15:
             //Control byte + len
@@ -473,7 +735,7 @@ func (e *Encoder) encodeMapHeader(l int) error {
             }
 
         default:
-            panic("Array size larger than 4294967295!")
+            return &SizeLimitError{ "map", l }
     }
 
     return nil
@@ -500,13 +762,25 @@ func (e *Encoder) encodeMapEntity(key interface{}, val interface{}) error {
 // | 0xde | YYYYYYYY * 2 | data - [map16] up to 65535 elements
 // | 0xdf | YYYYYYYY * 4 | data - [map32] up to 4294967295 elements
 func (e *Encoder) encodeMap(typ reflect.Type, val reflect.Value) error {
+    //Canonical maps are written in key order
+    keys := val.MapKeys()
+    if e.canonical {
+        ks := make([]interface{}, len(keys))
+        vs := make([]interface{}, len(keys))
+        for i:=0; i<len(keys); i++ {
+            ks[i] = keys[i].Interface()
+            vs[i] = val.MapIndex(keys[i]).Interface()
+        }
+
+        return e.encodeSortedEntries(ks, vs)
+    }
+
     l := val.Len()
-    if err := e.encodeMapHeader(l); err != nil {
+    if err := e.writeMapHeader(l); err != nil {
         return err
     }
 
     //Actual data
-    keys := val.MapKeys()
     for i:=0; i<len(keys); i++ {
         if err := e.encodeMapEntity(keys[i].Interface(), val.MapIndex(keys[i]).Interface()); err != nil {
             return err
@@ -524,32 +798,67 @@ func (e *Encoder) encodeMap(typ reflect.Type, val reflect.Value) error {
 // | 0xde | YYYYYYYY * 2 | data - [map16] up to 65535 elements
 // | 0xdf | YYYYYYYY * 4 | data - [map32] up to 4294967295 elements
 func (e *Encoder) encodeStruct(t reflect.Type, v reflect.Value) error {
-    slen := v.NumField()
-    if err := e.encodeMapHeader(slen); err != nil {
+    //The plan leaves out omitted fields so they are not counted
+    sp := cachedStructPlan(t)
+    if e.canonical {
+        ks := make([]interface{}, len(sp.keys))
+        vs := make([]interface{}, len(sp.keys))
+        for i, key := range sp.keys {
+            ks[i] = key
+            vs[i] = v.Field(sp.index[i]).Interface()
+        }
+
+        return e.encodeSortedEntries(ks, vs)
+    }
+
+    if err := e.writeMapHeader(len(sp.keys)); err != nil {
         return err
     }
 
-    //Go through the struct
-    for i:=0; i<slen; i++ {
-        var tname *string
-        stval := t.Field(i)
+    //Field value
+    for i, key := range sp.keys {
+        if err := e.encodeMapEntity(key, v.Field(sp.index[i]).Interface()); err != nil {
+            return err
+        }
+    }
 
-        //Get any msgpack tags
-        if tval, ok := stval.Tag.Lookup("msgpack"); ok {
-            if stmp, omit := parseMsgPackTag(tval); omit && stmp == "" {
-                continue
-            } else if stmp != "" {
-                tname = &stmp
-            }
+    return nil
+}
+
+// Function encodes a map whose entries are sorted by the
+// encoded bytes of their keys
+func (e *Encoder) encodeSortedEntries(ks []interface{}, vs []interface{}) error {
+    //Encode every key on its own
+    type entry struct {
+        key []byte
+        val interface{}
+    }
+
+    entries := make([]entry, len(ks))
+    for i:=0; i<len(ks); i++ {
+        buf := bytes.Buffer{}
+        kenc := &Encoder{ wtr: &buf, canonical: e.canonical }
+        if err := kenc.Encode(ks[i]); err != nil {
+            return err
         }
 
-        //Struct type name
-        if tname == nil {
-            tname = &stval.Name
+        entries[i] = entry{ buf.Bytes(), vs[i] }
+    }
+
+    sort.Slice(entries, func(i, j int) bool {
+        return bytes.Compare(entries[i].key, entries[j].key) < 0
+    })
+
+    if err := e.writeMapHeader(len(entries)); err != nil {
+        return err
+    }
+
+    for i:=0; i<len(entries); i++ {
+        if _, err := e.wtr.Write(entries[i].key); err != nil {
+            return err
         }
 
-        //Field value
-        if err := e.encodeMapEntity(*tname, v.Field(i).Interface()); err != nil {
+        if err := e.Encode(entries[i].val); err != nil {
             return err
         }
     }
@@ -575,6 +884,80 @@ func parseMsgPackTag(t string) (fieldname string, omit bool) {
 
 // Function encodes the interface
 func (e *Encoder) Encode(v interface{}) error {
+    //Types that encode themselves are written through as is
+    if m, ok := v.(Marshaler); ok {
+        if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+            return EncodeNil(e.wtr)
+        }
+
+        b, err := m.MsgPackMarshaler()
+        if err != nil {
+            return err
+        }
+
+        _, err = e.wtr.Write(b)
+        return err
+    }
+
+    //Generated encoders write minimal forms in field order, so they
+    //are only used when no other output is asked for
+    if m, ok := v.(MsgMarshaler); ok && !e.canonical && !e.typeWidth {
+        if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+            return EncodeNil(e.wtr)
+        }
+
+        b, err := m.MarshalMsg(e.buf[:0])
+        if err != nil {
+            return err
+        }
+
+        e.buf = b
+        _, err = e.wtr.Write(b)
+        return err
+    }
+
+    //Dynamic values keep their own wire types
+    if val, ok := v.(Value); ok {
+        return val.encode(e)
+    }
+
+    //Integers use their smallest form unless asked otherwise
+    if e.canonical || !e.typeWidth {
+        switch val := v.(type) {
+            case int64:
+                return encodeIntMinimal(e.wtr, val)
+            case int32:
+                return encodeIntMinimal(e.wtr, int64(val))
+            case int16:
+                return encodeIntMinimal(e.wtr, int64(val))
+            case int8:
+                return encodeIntMinimal(e.wtr, int64(val))
+            case int:
+                return encodeIntMinimal(e.wtr, int64(val))
+
+            case uint64:
+                return encodeUintMinimal(e.wtr, val)
+            case uint32:
+                return encodeUintMinimal(e.wtr, uint64(val))
+            case uint16:
+                return encodeUintMinimal(e.wtr, uint64(val))
+            case uint8:
+                return encodeUintMinimal(e.wtr, uint64(val))
+            case uint:
+                return encodeUintMinimal(e.wtr, uint64(val))
+        }
+    }
+
+    //Canonical floats use their smallest form
+    if e.canonical {
+        switch val := v.(type) {
+            case float64:
+                return encodeFloatCanonical(e.wtr, val)
+            case float32:
+                return encodeFloatCanonical(e.wtr, float64(val))
+        }
+    }
+
     //Check for base type encoding
     switch val := v.(type) {
 
@@ -621,6 +1004,10 @@ func (e *Encoder) Encode(v interface{}) error {
         case []byte:
             return EncodeBin(e.wtr, val)
 
+        //Extension
+        case Ext:
+            return EncodeExt(e.wtr, val.Type, val.Data)
+
         //Nil case
         case nil:
             return EncodeNil(e.wtr)
@@ -650,9 +1037,7 @@ func (e *Encoder) Encode(v interface{}) error {
             return e.Encode(reflect.Indirect(vptr).Interface())
     }
 
-    //TODO: Encode ext
-    log.Panicf("Unhandled type %T", v)
-    return nil
+    return &UnsupportedTypeError{ typ }
 }
 
 // Marshal function
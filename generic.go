@@ -0,0 +1,24 @@
+package msgpack
+
+// Function encodes v. Same as Marshal, typed for symmetry with
+// UnmarshalT.
+func MarshalT[T any](v T) ([]byte, error) {
+    return Marshal(v)
+}
+
+// Function decodes data into a new T
+//
+//  order, err := msgpack.UnmarshalT[Order](data)
+func UnmarshalT[T any](data []byte, opts ...DecoderOption) (T, error) {
+    var v T
+    err := Unmarshal(data, &v, opts...)
+    return v, err
+}
+
+// Function decodes the next value of d into a new T. Returns
+// io.EOF when there is no next value.
+func DecodeNext[T any](d *Decoder) (T, error) {
+    var v T
+    err := d.Decode(&v)
+    return v, err
+}
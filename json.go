@@ -0,0 +1,482 @@
+package msgpack
+import (
+    "encoding/base64"
+    "encoding/json"
+    "encoding/hex"
+    "unicode/utf8"
+    "strconv"
+    "bufio"
+    "strings"
+    "bytes"
+    "math"
+    "fmt"
+    "io"
+)
+
+// How bin data is written as a JSON string
+type BinEncoding int
+
+const (
+    BinBase64 BinEncoding = iota
+    BinHex
+)
+
+// How NaN and infinite floats, which JSON cannot represent, are handled
+type NonFinitePolicy int
+
+const (
+    NonFiniteError NonFinitePolicy = iota   // Fail the conversion
+    NonFiniteNull                           // Write null
+    NonFiniteString                         // Write "NaN", "+Inf" or "-Inf"
+)
+
+// Options for converting between msgpack and JSON. The zero value
+// is what ToJSON and FromJSON use.
+type JSONOptions struct {
+    Bin BinEncoding           // Encoding of bin and ext data
+    StrictKeys bool           // Fail on non-string map keys instead of stringifying them
+    NonFinite NonFinitePolicy
+    Limits DecoderLimits      // Applied to the msgpack input, and MaxDepth to JSON input
+
+    LargeNumbersAsStrings bool  // Keep JSON numbers that do not fit an int64, uint64 or float64 as str
+}
+
+// Error returned when a msgpack value has no JSON form
+type JSONValueError struct {
+    Value string
+    Offset int64
+}
+
+func (e *JSONValueError) Error() string {
+    return fmt.Sprintf("msgpack: cannot convert %s to JSON (offset %d)", e.Value, e.Offset)
+}
+
+// Function converts every msgpack value in src to a line of JSON
+// in dst using the default JSONOptions
+func ToJSON(dst io.Writer, src io.Reader) error {
+    return JSONOptions{}.ToJSON(dst, src)
+}
+
+// Method converts every msgpack value in src to a line of JSON in
+// dst. Values are converted token by token as they are read, without
+// building them in memory. Bin is written as a string, ext as an
+// object {"$ext": type, "data": string} and non-string keys as
+// their JSON text in a string.
+func (o JSONOptions) ToJSON(dst io.Writer, src io.Reader) (err error) {
+    t := jsonWriter{ o, NewDecoder(src, o.Limits), bufio.NewWriter(dst) }
+
+    //Values converted before an error are still written
+    defer func() {
+        if ferr := t.wtr.Flush(); err == nil {
+            err = ferr
+        }
+    }()
+
+    for {
+        tok, err := t.dec.Token()
+        if err == io.EOF {
+            break
+        } else if err != nil {
+            return err
+        }
+
+        if err := t.value(tok); err != nil {
+            return err
+        }
+
+        t.wtr.WriteByte('\n')
+    }
+
+    return nil
+}
+
+// Converts a token stream to JSON text
+type jsonWriter struct {
+    opts JSONOptions
+    dec *Decoder
+    wtr *bufio.Writer
+}
+
+// Method writes the value starting with tok
+func (t *jsonWriter) value(tok Token) error {
+    switch v := tok.(type) {
+        case nil:
+            t.wtr.WriteString("null")
+        case bool:
+            t.wtr.WriteString(strconv.FormatBool(v))
+
+        case int8:
+            t.wtr.WriteString(strconv.FormatInt(int64(v), 10))
+        case int16:
+            t.wtr.WriteString(strconv.FormatInt(int64(v), 10))
+        case int32:
+            t.wtr.WriteString(strconv.FormatInt(int64(v), 10))
+        case int64:
+            t.wtr.WriteString(strconv.FormatInt(v, 10))
+        case uint8:
+            t.wtr.WriteString(strconv.FormatUint(uint64(v), 10))
+        case uint16:
+            t.wtr.WriteString(strconv.FormatUint(uint64(v), 10))
+        case uint32:
+            t.wtr.WriteString(strconv.FormatUint(uint64(v), 10))
+        case uint64:
+            t.wtr.WriteString(strconv.FormatUint(v, 10))
+
+        case float32:
+            return t.float(float64(v), 32)
+        case float64:
+            return t.float(v, 64)
+
+        case string:
+            writeJSONString(t.wtr, v)
+        case []byte:
+            writeJSONString(t.wtr, t.bin(v))
+        case Ext:
+            t.wtr.WriteString(`{"$ext":`)
+            t.wtr.WriteString(strconv.Itoa(int(v.Type)))
+            t.wtr.WriteString(`,"data":`)
+            writeJSONString(t.wtr, t.bin(v.Data))
+            t.wtr.WriteByte('}')
+
+        case ArrayStart:
+            return t.array(int(v))
+        case MapStart:
+            return t.object(int(v))
+    }
+
+    return nil
+}
+
+// Method writes a float, applying the NonFinite policy
+func (t *jsonWriter) float(f float64, bits int) error {
+    if !math.IsNaN(f) && !math.IsInf(f, 0) {
+        t.wtr.WriteString(strconv.FormatFloat(f, 'g', -1, bits))
+        return nil
+    }
+
+    switch t.opts.NonFinite {
+        case NonFiniteNull:
+            t.wtr.WriteString("null")
+        case NonFiniteString:
+            writeJSONString(t.wtr, strconv.FormatFloat(f, 'g', -1, bits))
+        default:
+            return &JSONValueError{ strconv.FormatFloat(f, 'g', -1, bits), t.dec.tokOff }
+    }
+
+    return nil
+}
+
+// Method returns bin data as text
+func (t *jsonWriter) bin(b []byte) string {
+    if t.opts.Bin == BinHex {
+        return hex.EncodeToString(b)
+    }
+
+    return base64.StdEncoding.EncodeToString(b)
+}
+
+// Method writes the n elements of an array
+func (t *jsonWriter) array(n int) error {
+    if err := t.dec.enter(); err != nil {
+        return err
+    }
+    defer t.dec.leave()
+
+    t.wtr.WriteByte('[')
+    for i:=0; i<n; i++ {
+        if i > 0 {
+            t.wtr.WriteByte(',')
+        }
+
+        tok, err := t.dec.nextToken()
+        if err != nil {
+            return err
+        } else if err := t.value(tok); err != nil {
+            return err
+        }
+    }
+
+    t.wtr.WriteByte(']')
+    return nil
+}
+
+// Method writes the n pairs of a map
+func (t *jsonWriter) object(n int) error {
+    if err := t.dec.enter(); err != nil {
+        return err
+    }
+    defer t.dec.leave()
+
+    t.wtr.WriteByte('{')
+    for i:=0; i<n; i++ {
+        if i > 0 {
+            t.wtr.WriteByte(',')
+        }
+
+        tok, err := t.dec.nextToken()
+        if err != nil {
+            return err
+        } else if err := t.key(tok); err != nil {
+            return err
+        }
+
+        t.wtr.WriteByte(':')
+        if tok, err = t.dec.nextToken(); err != nil {
+            return err
+        } else if err := t.value(tok); err != nil {
+            return err
+        }
+    }
+
+    t.wtr.WriteByte('}')
+    return nil
+}
+
+// Method writes a map key. Keys other than str are written as
+// a string holding their JSON text.
+func (t *jsonWriter) key(tok Token) error {
+    switch v := tok.(type) {
+        case string:
+            writeJSONString(t.wtr, v)
+            return nil
+        case []byte:
+            if !t.opts.StrictKeys {
+                writeJSONString(t.wtr, t.bin(v))
+                return nil
+            }
+    }
+
+    if t.opts.StrictKeys {
+        return &JSONValueError{ t.dec.k.Type().String() + " map key", t.dec.tokOff }
+    }
+
+    //Render the key on its own, then quote it
+    wtr := t.wtr
+    buf := bytes.Buffer{}
+    t.wtr = bufio.NewWriter(&buf)
+    err := t.value(tok)
+    t.wtr.Flush()
+    t.wtr = wtr
+    if err != nil {
+        return err
+    }
+
+    writeJSONString(t.wtr, buf.String())
+    return nil
+}
+
+// Function writes s as a JSON string. Invalid UTF-8 is replaced
+// by U+FFFD.
+func writeJSONString(wtr *bufio.Writer, s string) {
+    const hexDigits = "0123456789abcdef"
+    wtr.WriteByte('"')
+    for i := 0; i < len(s); {
+        c := s[i]
+        if c < utf8.RuneSelf {
+            switch {
+                case c == '"' || c == '\\':
+                    wtr.WriteByte('\\')
+                    wtr.WriteByte(c)
+                case c == '\n':
+                    wtr.WriteString(`\n`)
+                case c == '\r':
+                    wtr.WriteString(`\r`)
+                case c == '\t':
+                    wtr.WriteString(`\t`)
+                case c < 0x20:
+                    wtr.WriteString(`\u00`)
+                    wtr.WriteByte(hexDigits[c >> 4])
+                    wtr.WriteByte(hexDigits[c & 0xf])
+                default:
+                    wtr.WriteByte(c)
+            }
+
+            i++
+            continue
+        }
+
+        r, size := utf8.DecodeRuneInString(s[i:])
+        if r == utf8.RuneError && size == 1 {
+            wtr.WriteRune(utf8.RuneError)
+        } else {
+            wtr.WriteString(s[i:i+size])
+        }
+
+        i += size
+    }
+
+    wtr.WriteByte('"')
+}
+
+// Function converts every JSON value in src to a msgpack value in
+// dst using the default JSONOptions
+func FromJSON(dst io.Writer, src io.Reader) error {
+    return JSONOptions{}.FromJSON(dst, src)
+}
+
+// Method converts every JSON value in src to a msgpack value in dst.
+// Integers become the smallest int or uint, other numbers float64.
+// msgpack headers carry element counts, so each top level value is
+// collected before it is written.
+func (o JSONOptions) FromJSON(dst io.Writer, src io.Reader) (err error) {
+    dec := json.NewDecoder(src)
+    dec.UseNumber()
+
+    //Values converted before an error are still written
+    wtr := bufio.NewWriter(dst)
+    defer func() {
+        if ferr := wtr.Flush(); err == nil {
+            err = ferr
+        }
+    }()
+
+    r := jsonReader{ opts: o, dec: dec }
+    for {
+        tok, err := dec.Token()
+        if err == io.EOF {
+            break
+        } else if err != nil {
+            return err
+        }
+
+        r.buf.Reset()
+        r.headers = r.headers[:0]
+        if err := r.value(tok); err != nil {
+            return err
+        } else if err := r.writeTo(wtr); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// Array or map header waiting for its element count
+type pendingHeader struct {
+    off int
+    isMap bool
+    n int
+}
+
+// Converts JSON tokens to msgpack. Values are encoded into buf
+// without their container headers, which are inserted by writeTo.
+type jsonReader struct {
+    opts JSONOptions
+    dec *json.Decoder
+    buf bytes.Buffer
+    headers []pendingHeader
+    depth int
+}
+
+// Method encodes the value starting with tok
+func (r *jsonReader) value(tok json.Token) error {
+    switch v := tok.(type) {
+        case nil:
+            return EncodeNil(&r.buf)
+        case bool:
+            return EncodeBool(&r.buf, v)
+        case string:
+            return EncodeString(&r.buf, v)
+        case json.Number:
+            return r.number(string(v))
+        case json.Delim:
+            return r.container(v == '{')
+    }
+
+    return fmt.Errorf("msgpack: unexpected JSON token %v", tok)
+}
+
+// Method encodes a JSON number in its smallest form
+func (r *jsonReader) number(s string) error {
+    if !strings.ContainsAny(s, ".eE") {
+        if s[0] == '-' {
+            if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+                return encodeIntMinimal(&r.buf, i)
+            }
+        } else if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+            return encodeUintMinimal(&r.buf, u)
+        }
+
+        if r.opts.LargeNumbersAsStrings {
+            return EncodeString(&r.buf, s)
+        }
+    }
+
+    f, err := strconv.ParseFloat(s, 64)
+    if err != nil && r.opts.LargeNumbersAsStrings {
+        return EncodeString(&r.buf, s)
+    } else if err != nil {
+        return fmt.Errorf("msgpack: JSON number %s out of range (offset %d)", s, r.dec.InputOffset())
+    }
+
+    return EncodeFloat64(&r.buf, f)
+}
+
+// Method encodes the elements of an array or the pairs of an object
+func (r *jsonReader) container(isMap bool) error {
+    r.depth++
+    defer func() { r.depth-- }()
+    if max := r.opts.Limits.MaxDepth; max > 0 && r.depth > max {
+        return &LimitError{ "MaxDepth", int64(r.depth), int64(max), r.dec.InputOffset() }
+    }
+
+    idx := len(r.headers)
+    r.headers = append(r.headers, pendingHeader{ off: r.buf.Len(), isMap: isMap })
+
+    n := 0
+    for ; r.dec.More(); n++ {
+        tok, err := r.dec.Token()
+        if err != nil {
+            return err
+        }
+
+        //Object keys are always strings
+        if isMap {
+            if err := EncodeString(&r.buf, tok.(string)); err != nil {
+                return err
+            } else if tok, err = r.dec.Token(); err != nil {
+                return err
+            }
+        }
+
+        if err := r.value(tok); err != nil {
+            return err
+        }
+    }
+
+    //Closing delimiter
+    if _, err := r.dec.Token(); err != nil {
+        return err
+    }
+
+    r.headers[idx].n = n
+    return nil
+}
+
+// Method writes the encoded value with its headers in place
+func (r *jsonReader) writeTo(wtr io.Writer) error {
+    e := NewEncoder(wtr)
+    data := r.buf.Bytes()
+    prev := 0
+    for _, h := range r.headers {
+        if _, err := wtr.Write(data[prev:h.off]); err != nil {
+            return err
+        }
+
+        var err error
+        if h.isMap {
+            err = e.writeMapHeader(h.n)
+        } else {
+            err = e.writeArrayHeader(h.n)
+        }
+
+        if err != nil {
+            return err
+        }
+
+        prev = h.off
+    }
+
+    _, err := wtr.Write(data[prev:])
+    return err
+}
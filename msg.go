@@ -0,0 +1,469 @@
+package msgpack
+import (
+    "reflect"
+    "strconv"
+    "strings"
+    "math"
+    "fmt"
+    "io"
+)
+
+// Implemented by types with generated encoders, see cmd/msgpackgen.
+// MarshalMsg appends the encoding of the value to b.
+type MsgMarshaler interface {
+    MarshalMsg(b []byte) ([]byte, error)
+}
+
+// Implemented by types with generated decoders. UnmarshalMsg decodes
+// the first value of b and returns the bytes after it. On error it
+// returns the bytes from the value that failed, which the offset
+// of the error is relative to.
+type MsgUnmarshaler interface {
+    UnmarshalMsg(b []byte) ([]byte, error)
+}
+
+// Implemented by types with generated encoders. Msgsize returns an
+// upper bound of the encoded size.
+type MsgSizer interface {
+    Msgsize() int
+}
+
+var msgUnmarshalerType = reflect.TypeOf((*MsgUnmarshaler)(nil)).Elem()
+
+// Upper bounds of encoded sizes, for Msgsize
+const (
+    NilSize = 1
+    BoolSize = 1
+    IntSize = 9
+    UintSize = 9
+    Float32Size = 5
+    Float64Size = 9
+    HeaderSize = 5   // Largest str, bin, array or map header
+)
+
+// Function returns the map key a struct field is encoded under: the
+// name from its msgpack tag, or the field name. ok is false for
+// unexported fields and fields tagged with only ",omitempty", which
+// are not encoded.
+func StructFieldKey(f reflect.StructField) (key string, ok bool) {
+    if f.PkgPath != "" {
+        return "", false
+    }
+
+    if tval, found := f.Tag.Lookup("msgpack"); found {
+        if name, omit := parseMsgPackTag(tval); omit && name == "" {
+            return "", false
+        } else if name != "" {
+            return name, true
+        }
+    }
+
+    return f.Name, true
+}
+
+/**************************/
+/** Start Append         **/
+/**************************/
+
+// Function appends a control byte followed by size big endian bytes of bits
+func appendFixed(b []byte, ctl Kind, bits uint64, size int) []byte {
+    b = append(b, byte(ctl))
+    for i:=size-1; i>=0; i-- {
+        b = append(b, byte(bits >> (8*uint(i))))
+    }
+
+    return b
+}
+
+// Function appends nil
+func AppendNil(b []byte) []byte {
+    return append(b, byte(Nil))
+}
+
+// Function appends a bool
+func AppendBool(b []byte, v bool) []byte {
+    if v {
+        return append(b, byte(True))
+    }
+
+    return append(b, byte(False))
+}
+
+// Function appends an integer in its smallest form
+func AppendInt(b []byte, v int64) []byte {
+    switch {
+        case v >= 0:
+            return AppendUint(b, uint64(v))
+        case v >= -32:
+            return append(b, byte(v))
+        case v >= math.MinInt8:
+            return appendFixed(b, Int8, uint64(v), 1)
+        case v >= math.MinInt16:
+            return appendFixed(b, Int16, uint64(v), 2)
+        case v >= math.MinInt32:
+            return appendFixed(b, Int32, uint64(v), 4)
+    }
+
+    return appendFixed(b, Int64, uint64(v), 8)
+}
+
+// Function appends an unsigned integer in its smallest form
+func AppendUint(b []byte, v uint64) []byte {
+    switch {
+        case v <= 0x7f:
+            return append(b, byte(v))
+        case v <= math.MaxUint8:
+            return appendFixed(b, Uint8, v, 1)
+        case v <= math.MaxUint16:
+            return appendFixed(b, Uint16, v, 2)
+        case v <= math.MaxUint32:
+            return appendFixed(b, Uint32, v, 4)
+    }
+
+    return appendFixed(b, Uint64, v, 8)
+}
+
+// Function appends a float32
+func AppendFloat32(b []byte, f float32) []byte {
+    return appendFixed(b, Float32, uint64(math.Float32bits(f)), 4)
+}
+
+// Function appends a float64
+func AppendFloat64(b []byte, f float64) []byte {
+    return appendFixed(b, Float64, math.Float64bits(f), 8)
+}
+
+// Function appends a header of the smallest of fix, 8, 16 and 32
+// bit lengths. fix is 0 for formats without a fix form.
+func appendHeader(b []byte, fix Kind, fixMax int, k8 Kind, l int) []byte {
+    switch {
+        case fix != 0 && l <= fixMax:
+            return append(b, byte(fix) | byte(l))
+        case k8 != 0 && l <= math.MaxUint8:
+            return appendFixed(b, k8, uint64(l), 1)
+        case l <= math.MaxUint16:
+            return appendFixed(b, k8+1, uint64(l), 2)
+    }
+
+    return appendFixed(b, k8+2, uint64(l), 4)
+}
+
+// Function appends a str
+func AppendString(b []byte, s string) []byte {
+    b = appendHeader(b, FixStr, 31, Str8, len(s))
+    return append(b, s...)
+}
+
+// Function appends a bin. A nil slice is an empty bin, as Encode
+// writes it.
+func AppendBytes(b []byte, v []byte) []byte {
+    b = appendHeader(b, 0, 0, Bin8, len(v))
+    return append(b, v...)
+}
+
+// Function appends an array header for n elements
+func AppendArrayHeader(b []byte, n int) []byte {
+    if n <= 0x0f {
+        return append(b, byte(FixArray) | byte(n))
+    } else if n <= math.MaxUint16 {
+        return appendFixed(b, Array16, uint64(n), 2)
+    }
+
+    return appendFixed(b, Array32, uint64(n), 4)
+}
+
+// Function appends a map header for n pairs
+func AppendMapHeader(b []byte, n int) []byte {
+    if n <= 0x0f {
+        return append(b, byte(FixMap) | byte(n))
+    } else if n <= math.MaxUint16 {
+        return appendFixed(b, Map16, uint64(n), 2)
+    }
+
+    return appendFixed(b, Map32, uint64(n), 4)
+}
+
+// Function appends any value using reflection, for types generated
+// code does not handle itself
+func AppendInterface(b []byte, v interface{}) ([]byte, error) {
+    if m, ok := v.(MsgMarshaler); ok {
+        return m.MarshalMsg(b)
+    }
+
+    enc, err := Marshal(v)
+    if err != nil {
+        return b, err
+    }
+
+    return append(b, enc...), nil
+}
+
+// Function returns the encoded size of any value, for types
+// generated code does not handle itself
+func InterfaceSize(v interface{}) int {
+    if s, ok := v.(MsgSizer); ok {
+        return s.Msgsize()
+    }
+
+    enc, _ := Marshal(v)
+    return len(enc)
+}
+
+/************************/
+/** End Append         **/
+/************************/
+
+/**************************/
+/** Start Read Bytes     **/
+/**************************/
+
+// Function returns a decoder reading b. It lives on the caller's
+// stack so reading needs no allocation.
+func bytesReader(b []byte) Decoder {
+    return Decoder{ buf: b, w: len(b), eof: true }
+}
+
+// Integer types by size, for overflow errors
+var intTypes = map[int]reflect.Type{
+    8: reflect.TypeOf(int8(0)), 16: reflect.TypeOf(int16(0)), 32: reflect.TypeOf(int32(0)),
+}
+
+var uintTypes = map[int]reflect.Type{
+    8: reflect.TypeOf(uint8(0)), 16: reflect.TypeOf(uint16(0)), 32: reflect.TypeOf(uint32(0)),
+}
+
+// Function reports whether b starts with nil
+func IsNil(b []byte) bool {
+    return len(b) > 0 && Kind(b[0]) == Nil
+}
+
+// Function reads a nil
+func ReadNilBytes(b []byte) ([]byte, error) {
+    d := bytesReader(b)
+    if err := d.ReadNil(); err != nil {
+        return b, err
+    }
+
+    return b[d.r:], nil
+}
+
+// Function reads a bool
+func ReadBoolBytes(b []byte) (bool, []byte, error) {
+    d := bytesReader(b)
+    v, err := d.ReadBool()
+    if err != nil {
+        return false, b, err
+    }
+
+    return v, b[d.r:], nil
+}
+
+// Function reads an integer that fits a signed integer of bits
+// bits, 0 meaning the size of int
+func ReadIntBytes(b []byte, bits int) (int64, []byte, error) {
+    if bits == 0 {
+        bits = strconv.IntSize
+    }
+
+    d := bytesReader(b)
+    v, err := d.ReadInt64()
+    if err == nil && bits < 64 && (v < -1 << uint(bits-1) || v > 1 << uint(bits-1) - 1) {
+        err = d.overflow(v, reflect.New(intTypes[bits]).Elem())
+    }
+
+    if err != nil {
+        return 0, b, err
+    }
+
+    return v, b[d.r:], nil
+}
+
+// Function reads an integer that fits an unsigned integer of bits
+// bits, 0 meaning the size of uint
+func ReadUintBytes(b []byte, bits int) (uint64, []byte, error) {
+    if bits == 0 {
+        bits = strconv.IntSize
+    }
+
+    d := bytesReader(b)
+    v, err := d.ReadUint64()
+    if err == nil && bits < 64 && v > 1 << uint(bits) - 1 {
+        err = d.overflow(v, reflect.New(uintTypes[bits]).Elem())
+    }
+
+    if err != nil {
+        return 0, b, err
+    }
+
+    return v, b[d.r:], nil
+}
+
+// Function reads a float32 or float64
+func ReadFloat64Bytes(b []byte) (float64, []byte, error) {
+    d := bytesReader(b)
+    v, err := d.ReadFloat64()
+    if err != nil {
+        return 0, b, err
+    }
+
+    return v, b[d.r:], nil
+}
+
+// Function reads a str, or a bin as Decode does
+func ReadStringBytes(b []byte) (string, []byte, error) {
+    d := bytesReader(b)
+    _, size, err := d.readTyped(stringType, StringType, BinType)
+    if err != nil {
+        return "", b, err
+    } else if d.w-d.r < size {
+        return "", b, io.ErrUnexpectedEOF
+    }
+
+    return string(b[d.r:d.r+size]), b[d.r+size:], nil
+}
+
+// Function reads a bin or a str as Decode does, or nil
+func ReadBytesBytes(b []byte) ([]byte, []byte, error) {
+    if IsNil(b) {
+        return nil, b[1:], nil
+    }
+
+    d := bytesReader(b)
+    _, size, err := d.readTyped(bytesType, BinType, StringType)
+    if err != nil {
+        return nil, b, err
+    } else if d.w-d.r < size {
+        return nil, b, io.ErrUnexpectedEOF
+    }
+
+    return append([]byte{}, b[d.r:d.r+size]...), b[d.r+size:], nil
+}
+
+// Function reads an array header. Counts larger than the bytes
+// left are rejected so callers can allocate for n elements.
+func ReadArrayHeaderBytes(b []byte) (int, []byte, error) {
+    d := bytesReader(b)
+    n, err := d.ReadArrayHeader()
+    if err == nil && n > d.w-d.r {
+        err = io.ErrUnexpectedEOF
+    }
+
+    if err != nil {
+        return 0, b, err
+    }
+
+    return n, b[d.r:], nil
+}
+
+// Function reads a map header. Counts larger than the bytes left
+// are rejected so callers can allocate for n pairs.
+func ReadMapHeaderBytes(b []byte) (int, []byte, error) {
+    d := bytesReader(b)
+    n, err := d.ReadMapHeader()
+    if err == nil && 2*n > d.w-d.r {
+        err = io.ErrUnexpectedEOF
+    }
+
+    if err != nil {
+        return 0, b, err
+    }
+
+    return n, b[d.r:], nil
+}
+
+// Function reads a map key for matching struct fields. str and bin
+// keys are returned without copying; other keys are formatted the
+// way Decode matches them.
+func ReadMapKeyBytes(b []byte) ([]byte, []byte, error) {
+    d := bytesReader(b)
+    cbyte, err := d.peekByte()
+    if err != nil {
+        return nil, b, err
+    }
+
+    if t := kindOf(cbyte).Type(); t == StringType || t == BinType {
+        _, l, err := d.readHeader()
+        if err != nil {
+            return nil, b, err
+        } else if d.w-d.r < l {
+            return nil, b, io.ErrUnexpectedEOF
+        }
+
+        return b[d.r:d.r+l], b[d.r+l:], nil
+    }
+
+    tok, err := d.nextToken()
+    if err != nil {
+        return nil, b, err
+    }
+
+    v, err := d.decodeInterface(tok)
+    if err != nil {
+        return nil, b, err
+    }
+
+    return []byte(fmt.Sprint(v)), b[d.r:], nil
+}
+
+// Function skips the first value of b
+func SkipBytes(b []byte) ([]byte, error) {
+    d := bytesReader(b)
+    if err := d.discard(); err != nil {
+        return b, err
+    }
+
+    return b[d.r:], nil
+}
+
+// Function decodes the first value of b into v using reflection,
+// for types generated code does not handle itself
+func UnmarshalNext(b []byte, v interface{}) ([]byte, error) {
+    if u, ok := v.(MsgUnmarshaler); ok {
+        return u.UnmarshalMsg(b)
+    }
+
+    d := bytesReader(b)
+    if err := d.Decode(v); err == io.EOF {
+        return b, io.ErrUnexpectedEOF
+    } else if err != nil {
+        return b, err
+    }
+
+    return b[d.r:], nil
+}
+
+// Function adds where a generated decoder failed to a type error.
+// v points to the Go value that was being decoded and path leads to
+// it from the struct: keys of fields and maps, and int indexes of
+// array elements. The innermost call sets the Go type, outer ones
+// prefix their path. Other errors are returned as is.
+func FieldError(err error, v interface{}, path ...interface{}) error {
+    terr, ok := err.(*UnmarshalTypeError)
+    if !ok {
+        return err
+    } else if terr.Field == "" {
+        terr.Type = reflect.TypeOf(v).Elem()
+    }
+
+    var sb strings.Builder
+    for _, p := range path {
+        if i, ok := p.(int); ok {
+            fmt.Fprintf(&sb, "[%d]", i)
+        } else {
+            fmt.Fprintf(&sb, ".%v", p)
+        }
+    }
+
+    if terr.Field != "" && terr.Field[0] != '[' {
+        sb.WriteByte('.')
+    }
+
+    //Struct names the root, which is now further out
+    sb.WriteString(terr.Field)
+    terr.Struct, terr.Field = "", strings.TrimPrefix(sb.String(), ".")
+    return terr
+}
+
+/************************/
+/** End Read Bytes     **/
+/************************/
@@ -1,5 +1,35 @@
 package msgpack
 
+// RawMessage is one encoded msgpack value. It captures the
+// value's bytes during Decode and is written through unchanged
+// by Encode, so decoding part of a message can be deferred.
+type RawMessage []byte
+
+// Method returns the encoded value. An empty RawMessage encodes
+// as nil.
+func (m RawMessage) MsgPackMarshaler() ([]byte, error) {
+    if len(m) == 0 {
+        return []byte{ byte(Nil) }, nil
+    }
+
+    return m, nil
+}
+
+// Method returns the kind of the encoded value
+func (m RawMessage) Kind() Kind {
+    if len(m) == 0 {
+        return Nil
+    }
+
+    return kindOf(m[0])
+}
+
+// Method stores a copy of the encoded value
+func (m *RawMessage) MsgPackUnmarshaler(data []byte) error {
+    *m = append((*m)[:0], data...)
+    return nil
+}
+
 type Kind byte
 
 // Signed integers
@@ -20,8 +50,65 @@ const (
 
 // FixNums
 const (
-    FixInt Kind = 0xe0   // 0x0XXXXXXX (0 == control bit)
-    FixUint Kind = 0x00  // 0x111YYYYY (111 == control bit)
+    FixInt Kind = 0xe0   // 0x111YYYYY (111 == control bit)
+    FixUint Kind = 0x00  // 0x0XXXXXXX (0 == control bit)
+)
+
+// Nil and booleans
+const (
+    Nil Kind = 0xc0
+    False Kind = 0xc2
+    True Kind = 0xc3
+)
+
+// Floats
+const (
+    Float32 Kind = 0xca
+    Float64 Kind = 0xcb
+)
+
+// Strings
+const (
+    FixStr Kind = 0xa0  // 0x101XXXXX (101 == control bit)
+    Str8 Kind = 0xd9
+    Str16 Kind = 0xda
+    Str32 Kind = 0xdb
+)
+
+// Binary
+const (
+    Bin8 Kind = iota + 0xc4
+    Bin16
+    Bin32
+)
+
+// Arrays
+const (
+    FixArray Kind = 0x90  // 0x1001XXXX (1001 == control bit)
+    Array16 Kind = 0xdc
+    Array32 Kind = 0xdd
+)
+
+// Maps
+const (
+    FixMap Kind = 0x80  // 0x1000XXXX (1000 == control bit)
+    Map16 Kind = 0xde
+    Map32 Kind = 0xdf
+)
+
+// Extensions
+const (
+    FixExt1 Kind = iota + 0xd4
+    FixExt2
+    FixExt4
+    FixExt8
+    FixExt16
+)
+
+const (
+    Ext8 Kind = iota + 0xc7
+    Ext16
+    Ext32
 )
 
 // String interface for Kind type
@@ -49,7 +136,159 @@ func (k Kind) String() string {
            return "FixInt"
         case FixUint:
            return "FixUint"
+
+        case Nil:
+            return "Nil"
+        case False:
+            return "False"
+        case True:
+            return "True"
+
+        case Float32:
+            return "Float32"
+        case Float64:
+            return "Float64"
+
+        case FixStr:
+            return "FixStr"
+        case Str8:
+            return "Str8"
+        case Str16:
+            return "Str16"
+        case Str32:
+            return "Str32"
+
+        case Bin8:
+            return "Bin8"
+        case Bin16:
+            return "Bin16"
+        case Bin32:
+            return "Bin32"
+
+        case FixArray:
+            return "FixArray"
+        case Array16:
+            return "Array16"
+        case Array32:
+            return "Array32"
+
+        case FixMap:
+            return "FixMap"
+        case Map16:
+            return "Map16"
+        case Map32:
+            return "Map32"
+
+        case FixExt1:
+            return "FixExt1"
+        case FixExt2:
+            return "FixExt2"
+        case FixExt4:
+            return "FixExt4"
+        case FixExt8:
+            return "FixExt8"
+        case FixExt16:
+            return "FixExt16"
+        case Ext8:
+            return "Ext8"
+        case Ext16:
+            return "Ext16"
+        case Ext32:
+            return "Ext32"
     }
 
     return "unknown"
 }
+
+// Type groups kinds into the msgpack format families
+type Type byte
+
+const (
+    InvalidType Type = iota
+    NilType
+    BoolType
+    IntType
+    UintType
+    FloatType
+    StringType
+    BinType
+    ArrayType
+    MapType
+    ExtType
+)
+
+// String interface for Type type
+func (t Type) String() string {
+    switch t {
+        case NilType:
+            return "nil"
+        case BoolType:
+            return "bool"
+        case IntType:
+            return "int"
+        case UintType:
+            return "uint"
+        case FloatType:
+            return "float"
+        case StringType:
+            return "str"
+        case BinType:
+            return "bin"
+        case ArrayType:
+            return "array"
+        case MapType:
+            return "map"
+        case ExtType:
+            return "ext"
+    }
+
+    return "invalid"
+}
+
+// Function returns the kind of a control byte. Fix formats
+// are reported as FixUint, FixInt, FixStr, FixArray and FixMap
+// whatever value they carry.
+func kindOf(cbyte byte) Kind {
+    switch {
+        case cbyte & 0x80 == byte(FixUint):
+            return FixUint
+        case cbyte & 0xe0 == byte(FixInt):
+            return FixInt
+        case cbyte & 0xf0 == byte(FixMap):
+            return FixMap
+        case cbyte & 0xf0 == byte(FixArray):
+            return FixArray
+        case cbyte & 0xe0 == byte(FixStr):
+            return FixStr
+    }
+
+    return Kind(cbyte)
+}
+
+// Method returns the format family of the kind
+func (k Kind) Type() Type {
+    switch {
+        case k == Nil:
+            return NilType
+        case k == True || k == False:
+            return BoolType
+        case k == FixInt || (k >= Int8 && k <= Int64):
+            return IntType
+        case k == FixUint || (k >= Uint8 && k <= Uint64):
+            return UintType
+        case k == Float32 || k == Float64:
+            return FloatType
+        case k == FixStr || (k >= Str8 && k <= Str32):
+            return StringType
+        case k >= Bin8 && k <= Bin32:
+            return BinType
+        case k == FixArray || k == Array16 || k == Array32:
+            return ArrayType
+        case k == FixMap || k == Map16 || k == Map32:
+            return MapType
+        case (k >= FixExt1 && k <= FixExt16) || (k >= Ext8 && k <= Ext32):
+            return ExtType
+    }
+
+    return InvalidType
+}
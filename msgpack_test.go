@@ -1,11 +1,17 @@
 package msgpack
 import (
+    "sort"
+    "testing/iotest"
     "testing"
     "strings"
     "reflect"
+    "errors"
     "bytes"
+    "math"
     "log"
     "fmt"
+    "net"
+    "io"
 )
 
 // Function generates chars into a string build from 0x31 to 0x7e
@@ -39,7 +45,7 @@ func decodeDebug(t *testing.T, dec *Decoder, v interface{}) {
 }
 
 func TestInt(t *testing.T) {
-    bknown := []byte{ 0xe3, 0xd1, 0x40, 0x74, 0xd2, 0x00, 0x10, 0x00,
+    bknown := []byte{ 0xfd, 0xd1, 0x40, 0x74, 0xd2, 0x00, 0x10, 0x00,
                       0x00, 0xd3, 0x00, 0x33, 0xff, 0xaa, 0xbb, 0xcc,
                       0xee, 0xff, 0xd3, 0x00, 0x33, 0xff, 0xaa, 0xbb,
                       0xcc, 0xee, 0xff }
@@ -54,6 +60,7 @@ func TestInt(t *testing.T) {
     //Encode the above native types
     buf := bytes.Buffer{}
     enc := NewEncoder(&buf)
+    enc.SetTypeWidthInts(true)
     encodeDebug(t, enc, &buf, fixint)
     encodeDebug(t, enc, &buf, integ16)
     encodeDebug(t, enc, &buf, integ32)
@@ -62,7 +69,7 @@ func TestInt(t *testing.T) {
 
     //Check if bytes are same
     if bytes.Compare(buf.Bytes(), bknown) != 0 {
-        panic("Bytes mismatch!")
+        panic("Bytes mismatch!\n" + annotateMismatch(buf.Bytes(), bknown))
     }
 
     //Decode
@@ -75,6 +82,51 @@ func TestInt(t *testing.T) {
     decodeDebug(t, dec, integ64)
 }
 
+// Test integers are encoded by value instead of Go type width
+func TestMinimalInt(t *testing.T) {
+    bknown := []byte{ 0xe0, 0xd0, 0xdf, 0xcc, 0xc8, 0x05, 0xd1, 0xff,
+                      0x38, 0xcd, 0x40, 0x74, 0xd2, 0xff, 0xf0, 0x00,
+                      0x00, 0xcf, 0x00, 0x33, 0xff, 0xaa, 0xbb, 0xcc,
+                      0xee, 0xff }
+
+    buf := bytes.Buffer{}
+    enc := NewEncoder(&buf)
+    encodeDebug(t, enc, &buf, int8(-32))
+    encodeDebug(t, enc, &buf, int64(-33))
+    encodeDebug(t, enc, &buf, int64(200))
+    encodeDebug(t, enc, &buf, int(5))
+    encodeDebug(t, enc, &buf, int32(-200))
+    encodeDebug(t, enc, &buf, uint64(16500))
+    encodeDebug(t, enc, &buf, int(-1<<20))
+    encodeDebug(t, enc, &buf, int64(0x0033ffaabbcceeff))
+
+    if !bytes.Equal(buf.Bytes(), bknown) {
+        panic("Bytes mismatch!\n" + annotateMismatch(buf.Bytes(), bknown))
+    }
+
+    //Any width decodes into any type that holds the value
+    var i8 int8
+    var u16 uint16
+    var i64 int64
+    dec := NewDecoder(bytes.NewReader(bknown))
+    for _, v := range []interface{}{ &i8, &i64, &u16, &i8, &i64, &u16, &i64, &i64 } {
+        if err := dec.Decode(v); err != nil {
+            panic(err)
+        }
+    }
+
+    if i8 != 5 || u16 != 16500 || i64 != 0x0033ffaabbcceeff {
+        panic(fmt.Sprintf("Decoded numbers mismatch! %v %v %v", i8, u16, i64))
+    }
+
+    //Values that do not fit are rejected
+    if err := Unmarshal([]byte{ 0xcc, 0xc8 }, &i8); err == nil {
+        panic("Expected overflow error for 200 into int8")
+    } else if err := Unmarshal([]byte{ 0xff }, &u16); err == nil {
+        panic("Expected overflow error for -1 into uint16")
+    }
+}
+
 func TestUint(t *testing.T) {
     bknown := []byte{ 0xcc, 0xff, 0xcd, 0x40, 0x74, 0xce, 0x00, 0x10,
                       0x00, 0x00, 0xcf, 0x00, 0x33, 0xff, 0xaa, 0xbb,
@@ -217,6 +269,42 @@ func TestFloat(t *testing.T) {
     t.Logf("%.*s", buf.Len(), buf.Bytes())
 }
 
+// Test negative fixints are their two's compliment byte
+func TestNegativeFixInt(t *testing.T) {
+    buf := bytes.Buffer{}
+    enc := NewEncoder(&buf)
+    for _, v := range []int8{ -1, -3, -31, -32 } {
+        enc.Encode(v)
+    }
+
+    if !bytes.Equal(buf.Bytes(), []byte{ 0xff, 0xfd, 0xe1, 0xe0 }) {
+        panic(fmt.Sprintf("Bytes mismatch! 0x%x", buf.Bytes()))
+    }
+
+    //Every negative fixint byte decodes to its value
+    for b:=0xe0; b<=0xff; b++ {
+        dec := NewDecoder(bytes.NewReader([]byte{ byte(b) }))
+        if tok, err := dec.Token(); err != nil || tok != Token(int8(b - 0x100)) {
+            panic(fmt.Sprintf("Expected %d for 0x%02x, got %v (%v)", b - 0x100, b, tok, err))
+        }
+    }
+}
+
+// Test float64 uses its own control byte
+func TestFloat64(t *testing.T) {
+    buf := bytes.Buffer{}
+    enc := NewEncoder(&buf)
+    enc.Encode(float64(1.5))
+    if !bytes.Equal(buf.Bytes(), []byte{ 0xcb, 0x3f, 0xf8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00 }) {
+        panic(fmt.Sprintf("Bytes mismatch! 0x%x", buf.Bytes()))
+    }
+
+    dec := NewDecoder(&buf)
+    if tok, err := dec.Token(); err != nil || tok != Token(float64(1.5)) {
+        panic(fmt.Sprintf("Expected 1.5, got %v (%v)", tok, err))
+    }
+}
+
 // Test complicated struct
 func TestComplicatedStruct(t *testing.T) {
     st := struct{ Make string
@@ -301,3 +389,1525 @@ func TestUnmarshal(t *testing.T) {
         panic(fmt.Sprintf("Decoded numbers are not the same as encoded! %v != %v", inum, dinum))
     }
 }
+
+// Test decoding into structs with strict options
+func TestStrictDecode(t *testing.T) {
+    type Item struct {
+        Price int `msgpack:"price"`
+    }
+
+    type Order struct {
+        Id string `msgpack:"id"`
+        Items []Item `msgpack:"items"`
+    }
+
+    //Round trip
+    buf, err := Marshal(Order{ "A1", []Item{ { 3 }, { 4 } } })
+    if err != nil {
+        panic(err)
+    }
+
+    var order Order
+    if err := Unmarshal(buf, &order); err != nil {
+        panic(err)
+    } else if order.Id != "A1" || len(order.Items) != 2 || order.Items[1].Price != 4 {
+        panic(fmt.Sprintf("Decoded struct mismatch! %+v", order))
+    }
+
+    //Unknown field in a nested struct
+    buf, err = Marshal(map[string]interface{}{ "items": []map[string]int{ { "price": 1, "qty": 2 } } })
+    if err != nil {
+        panic(err)
+    }
+
+    dec := NewDecoder(bytes.NewReader(buf))
+    if err := dec.Decode(&order); err != nil {
+        panic(err)
+    }
+
+    dec = NewDecoder(bytes.NewReader(buf))
+    dec.DisallowUnknownFields()
+    err = dec.Decode(&order)
+    if ferr, ok := err.(*UnknownFieldError); !ok || ferr.Key != "qty" || ferr.Path != "Order.items[0]" {
+        panic(fmt.Sprintf("Expected unknown field error, got %v", err))
+    }
+    t.Log(err)
+
+    //Container keys are skipped whole: {[1]: "x", "id": "A2"}
+    cbuf := bytes.Buffer{}
+    enc := NewEncoder(&cbuf)
+    enc.WriteMapHeader(2)
+    enc.encodeMapEntity([]int{ 1 }, "x")
+    enc.encodeMapEntity("id", "A2")
+
+    order = Order{}
+    if err := Unmarshal(cbuf.Bytes(), &order); err != nil {
+        panic(err)
+    } else if order.Id != "A2" {
+        panic(fmt.Sprintf("Expected id after a container key, got %+v", order))
+    }
+
+    dec = NewDecoder(bytes.NewReader(cbuf.Bytes()))
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(&order); err == nil {
+        panic("Expected unknown field error for a container key")
+    }
+
+    //Duplicate keys: {"id": "a", "id": "b"}
+    dbuf := bytes.Buffer{}
+    enc = NewEncoder(&dbuf)
+    enc.WriteMapHeader(2)
+    enc.encodeMapEntity("id", "a")
+    enc.encodeMapEntity("id", "b")
+
+    policies := map[DuplicateKeyPolicy]string{ DuplicateKeysLastWins: "b", DuplicateKeysFirstWins: "a" }
+    for policy, id := range policies {
+        order = Order{}
+        dec = NewDecoder(bytes.NewReader(dbuf.Bytes()))
+        dec.SetDuplicateKeyPolicy(policy)
+        if err := dec.Decode(&order); err != nil {
+            panic(err)
+        } else if order.Id != id {
+            panic(fmt.Sprintf("Duplicate key policy %v: %q != %q", policy, order.Id, id))
+        }
+    }
+
+    m := map[string]string{}
+    dec = NewDecoder(bytes.NewReader(dbuf.Bytes()))
+    dec.SetDuplicateKeyPolicy(DuplicateKeysError)
+    err = dec.Decode(&m)
+    if derr, ok := err.(*DuplicateKeyError); !ok || derr.Key != "id" {
+        panic(fmt.Sprintf("Expected duplicate key error, got %v", err))
+    }
+    t.Log(err)
+}
+
+// Test map keys that cannot be stored in a Go map
+func TestMapKeys(t *testing.T) {
+    //bin keys become strings as in Value.Interface
+    var v interface{}
+    if err := Unmarshal([]byte{ 0x81, 0xc4, 0x01, 'a', 0x01 }, &v); err != nil {
+        panic(err)
+    } else if !reflect.DeepEqual(v, map[interface{}]interface{}{ "a": uint8(1) }) {
+        panic(fmt.Sprintf("bin key mismatch! %#v", v))
+    }
+
+    var sm map[string]interface{}
+    if err := Unmarshal([]byte{ 0x81, 0xc4, 0x01, 'a', 0x01 }, &sm); err != nil || sm["a"] != uint8(1) {
+        panic(fmt.Sprintf("bin key mismatch! %#v %v", sm, err))
+    }
+
+    //array, map and ext keys are rejected
+    var terr *UnmarshalTypeError
+    for _, data := range [][]byte{
+        { 0x81, 0x91, 0x01, 0x01 },
+        { 0x82, 0xa1, 'a', 0x01, 0x81, 0x01, 0x02, 0x03 },
+        { 0x81, 0xd4, 0x01, 0x02, 0x03 },
+    }{
+        if err := Unmarshal(data, &v); !errors.As(err, &terr) {
+            panic(fmt.Sprintf("Expected type error for %x, got %v", data, err))
+        } else if err := Unmarshal(data, &sm); err == nil {
+            panic(fmt.Sprintf("Expected error for %x into map[string]interface{}", data))
+        }
+        t.Log(terr)
+    }
+
+    if terr.Offset != 1 {
+        panic(fmt.Sprintf("Expected key offset 1, got %d", terr.Offset))
+    }
+}
+
+// Test canonical encoding produces identical bytes
+func TestCanonical(t *testing.T) {
+    m := map[string]interface{}{}
+    for i:=0; i<32; i++ {
+        m[fmt.Sprintf("key%d", i)] = int64(i * 1000)
+    }
+
+    //Same bytes on every run
+    var first []byte
+    for i:=0; i<10; i++ {
+        buf := bytes.Buffer{}
+        enc := NewEncoder(&buf)
+        enc.SetCanonical(true)
+        if err := enc.Encode(m); err != nil {
+            panic(err)
+        }
+
+        if first == nil {
+            first = buf.Bytes()
+        } else if !bytes.Equal(first, buf.Bytes()) {
+            panic("Canonical encoding is not deterministic!")
+        }
+    }
+
+    //Smallest integer and float forms, sorted keys
+    buf := bytes.Buffer{}
+    enc := NewEncoder(&buf)
+    enc.SetCanonical(true)
+    enc.Encode(map[string]interface{}{ "b": int64(200), "a": float64(1.5), "c": math.NaN() })
+    bknown := []byte{ 0x83, 0xa1, 'a', 0xca, 0x3f, 0xc0, 0x00, 0x00,
+                      0xa1, 'b', 0xcc, 0xc8,
+                      0xa1, 'c', 0xca, 0x7f, 0xc0, 0x00, 0x00 }
+    if !bytes.Equal(buf.Bytes(), bknown) {
+        panic(fmt.Sprintf("Bytes mismatch! 0x%x", buf.Bytes()))
+    }
+
+    //Negative fixints cover -32 to -1
+    buf.Reset()
+    enc.Encode([]int64{ -1, -31, -32, -33 })
+    if !bytes.Equal(buf.Bytes(), []byte{ 0x94, 0xff, 0xe1, 0xe0, 0xd0, 0xdf }) {
+        panic(fmt.Sprintf("Bytes mismatch! 0x%x", buf.Bytes()))
+    }
+
+    //Structs and maps with the same keys encode the same
+    st := struct{ B int64 `msgpack:"b"`
+                  A int64 `msgpack:"a"` }{ 2, 1 }
+    sbuf := bytes.Buffer{}
+    enc = NewEncoder(&sbuf)
+    enc.SetCanonical(true)
+    enc.Encode(st)
+
+    mbuf := bytes.Buffer{}
+    enc = NewEncoder(&mbuf)
+    enc.SetCanonical(true)
+    enc.Encode(map[string]int8{ "a": 1, "b": 2 })
+    if !bytes.Equal(sbuf.Bytes(), mbuf.Bytes()) {
+        panic(fmt.Sprintf("Bytes mismatch! 0x%x != 0x%x", sbuf.Bytes(), mbuf.Bytes()))
+    }
+}
+
+// Test encoding errors are returned instead of panicking
+func TestEncodeErrors(t *testing.T) {
+    buf := bytes.Buffer{}
+    enc := NewEncoder(&buf)
+
+    //Unsupported types, also nested
+    var terr *UnsupportedTypeError
+    if err := enc.Encode(make(chan int)); !errors.As(err, &terr) {
+        panic(fmt.Sprintf("Expected UnsupportedTypeError, got %v", err))
+    } else if _, err := Marshal(map[string]interface{}{ "f": func() {} }); !errors.As(err, &terr) {
+        panic(fmt.Sprintf("Expected UnsupportedTypeError, got %v", err))
+    }
+    t.Log(terr)
+
+    //Bad integer bit size
+    var verr *UnsupportedValueError
+    if err := EncodeInt(&buf, 1000, 12); !errors.As(err, &verr) {
+        panic(fmt.Sprintf("Expected UnsupportedValueError, got %v", err))
+    }
+    t.Log(verr)
+
+    //Zero sized elements let us build an array past the limit
+    var serr *SizeLimitError
+    if err := enc.Encode(make([]struct{}, math.MaxUint32+1)); !errors.As(err, &serr) || serr.Kind != "array" {
+        panic(fmt.Sprintf("Expected SizeLimitError, got %v", err))
+    }
+    t.Log(serr)
+}
+
+// Test decode errors report the offset and field path
+func TestDecodeErrors(t *testing.T) {
+    type Item struct {
+        Price float64 `msgpack:"price"`
+    }
+
+    type Order struct {
+        Items []Item `msgpack:"items"`
+    }
+
+    //Fourth item has a string price
+    items := []map[string]interface{}{ { "price": 1.0 }, { "price": 2.0 }, { "price": 3.0 }, { "price": "4" } }
+    buf, err := Marshal(map[string]interface{}{ "items": items })
+    if err != nil {
+        panic(err)
+    }
+
+    var order Order
+    err = Unmarshal(buf, &order)
+    var terr *UnmarshalTypeError
+    if !errors.As(err, &terr) || terr.Struct != "Order" || terr.Field != "items[3].price" || terr.Value != "str" {
+        panic(fmt.Sprintf("Expected UnmarshalTypeError, got %v", err))
+    } else if buf[terr.Offset] != 0xa1 {
+        panic(fmt.Sprintf("Offset %d does not point at the str", terr.Offset))
+    }
+    t.Log(err)
+
+    //Truncated values and clean EOF
+    if err := Unmarshal(buf[:len(buf)-1], &order); err != io.ErrUnexpectedEOF {
+        panic(fmt.Sprintf("Expected io.ErrUnexpectedEOF, got %v", err))
+    } else if err := Unmarshal([]byte{ 0xcd, 0x01 }, new(int)); err != io.ErrUnexpectedEOF {
+        panic(fmt.Sprintf("Expected io.ErrUnexpectedEOF, got %v", err))
+    } else if err := Unmarshal(nil, new(int)); err != io.EOF {
+        panic(fmt.Sprintf("Expected io.EOF, got %v", err))
+    }
+
+    //Reserved byte
+    var serr *SyntaxError
+    if err := Unmarshal([]byte{ 0x92, 0x01, 0xc1 }, new([]int)); !errors.As(err, &serr) || serr.Offset != 2 {
+        panic(fmt.Sprintf("Expected SyntaxError at offset 2, got %v", err))
+    }
+    t.Log(serr)
+}
+
+// Test decoder limits are checked before allocating
+func TestDecoderLimits(t *testing.T) {
+    limits := DecoderLimits{ MaxDepth: 3, MaxContainerLen: 1000, MaxDataLen: 1<<20, MaxBytes: 1<<22 }
+    tests := []struct{
+        data []byte
+        limit string
+    }{
+        { []byte{ 0xdd, 0xff, 0xff, 0xff, 0xff }, "MaxContainerLen" },
+        { []byte{ 0xdf, 0x00, 0x01, 0x00, 0x00 }, "MaxContainerLen" },
+        { []byte{ 0xdb, 0xff, 0xff, 0xff, 0xff }, "MaxDataLen" },
+        { []byte{ 0xc6, 0x00, 0x20, 0x00, 0x00 }, "MaxDataLen" },
+        { []byte{ 0x91, 0x91, 0x91, 0x91, 0x01 }, "MaxDepth" },
+    }
+
+    for _, test := range tests {
+        var v interface{}
+        var lerr *LimitError
+        if err := Unmarshal(test.data, &v, limits); !errors.As(err, &lerr) || lerr.Limit != test.limit {
+            panic(fmt.Sprintf("Expected %s LimitError for 0x%x, got %v", test.limit, test.data, err))
+        }
+        t.Log(lerr)
+    }
+
+    //Total budget across values
+    buf, err := Marshal([]string{ strings.Repeat("a", 600), strings.Repeat("b", 600) })
+    if err != nil {
+        panic(err)
+    }
+
+    var strs []string
+    var lerr *LimitError
+    if err := Unmarshal(buf, &strs, DecoderLimits{ MaxBytes: 1000 }); !errors.As(err, &lerr) || lerr.Limit != "MaxBytes" {
+        panic(fmt.Sprintf("Expected MaxBytes LimitError, got %v", err))
+    } else if err := Unmarshal(buf, &strs, limits); err != nil || len(strs) != 2 {
+        panic(fmt.Sprintf("Unexpected error within limits: %v", err))
+    }
+}
+
+// Test skipping values without decoding them
+func TestSkip(t *testing.T) {
+    //{"a": [1, {"b": "xyz"}, fixext4], "id": 7} followed by 300
+    data := []byte{ 0x82, 0xa1, 'a', 0x93, 0x01, 0x81, 0xa1, 'b', 0xa3, 'x', 'y', 'z',
+                    0xd6, 0x05, 0x01, 0x02, 0x03, 0x04,
+                    0xa2, 'i', 'd', 0x07,
+                    0xcd, 0x01, 0x2c }
+
+    //Unknown keys are skipped by the struct decoder
+    var st struct{ Id int `msgpack:"id"` }
+    dec := NewDecoder(bytes.NewReader(data))
+    if err := dec.Decode(&st); err != nil {
+        panic(err)
+    } else if st.Id != 7 {
+        panic(fmt.Sprintf("Decoded id mismatch! %v", st.Id))
+    }
+
+    //Skip the whole map and read what follows
+    var num int
+    dec = NewDecoder(bytes.NewReader(data))
+    if err := dec.Skip(); err != nil {
+        panic(err)
+    } else if err := dec.Decode(&num); err != nil || num != 300 {
+        panic(fmt.Sprintf("Value after skip mismatch! %v %v", num, err))
+    } else if err := dec.Skip(); err != io.EOF {
+        panic(fmt.Sprintf("Expected io.EOF, got %v", err))
+    }
+
+    //Truncated input
+    dec = NewDecoder(bytes.NewReader(data[:10]))
+    if err := dec.Skip(); err != io.ErrUnexpectedEOF {
+        panic(fmt.Sprintf("Expected io.ErrUnexpectedEOF, got %v", err))
+    }
+
+    //Skipping allocates nothing
+    rdr := bytes.NewReader(data)
+    dec = NewDecoder(rdr)
+    allocs := testing.AllocsPerRun(100, func() {
+        rdr.Reset(data)
+        dec.Skip()
+    })
+
+    if allocs != 0 {
+        panic(fmt.Sprintf("Skip allocated %v times", allocs))
+    }
+}
+
+// Test RawMessage defers decoding and re-encodes verbatim
+func TestRawMessage(t *testing.T) {
+    type Ping struct {
+        Seq int `msgpack:"seq"`
+    }
+
+    type Envelope struct {
+        Type string `msgpack:"type"`
+        Body RawMessage `msgpack:"body"`
+    }
+
+    body, err := Marshal(map[string]interface{}{ "seq": 42, "pad": []interface{}{ "x", 1.5, nil } })
+    if err != nil {
+        panic(err)
+    }
+
+    buf, err := Marshal(Envelope{ "ping", body })
+    if err != nil {
+        panic(err)
+    }
+
+    //Header first, body later
+    var env Envelope
+    if err := Unmarshal(buf, &env); err != nil {
+        panic(err)
+    } else if env.Type != "ping" || !bytes.Equal(env.Body, body) {
+        panic(fmt.Sprintf("Captured body mismatch! 0x%x != 0x%x", env.Body, body))
+    }
+
+    var ping Ping
+    if err := Unmarshal(env.Body, &ping); err != nil {
+        panic(err)
+    } else if ping.Seq != 42 {
+        panic(fmt.Sprintf("Deferred decode mismatch! %v", ping.Seq))
+    }
+
+    //Re-encoding writes the same bytes
+    if rebuf, err := Marshal(env); err != nil {
+        panic(err)
+    } else if !bytes.Equal(rebuf, buf) {
+        panic(fmt.Sprintf("Bytes mismatch! 0x%x != 0x%x", rebuf, buf))
+    }
+
+    //Top level and empty messages
+    var raw RawMessage
+    if err := Unmarshal(body, &raw); err != nil || !bytes.Equal(raw, body) {
+        panic(fmt.Sprintf("Top level raw mismatch! %v", err))
+    } else if b, _ := Marshal(RawMessage(nil)); !bytes.Equal(b, []byte{ 0xc0 }) {
+        panic(fmt.Sprintf("Empty raw should encode nil, got 0x%x", b))
+    }
+
+    //A nested capture leaves the outer one recording
+    dec := newBytesDecoder(buf)
+    dec.recording = true
+    dec.readByte()
+    inner, err := dec.readRaw()
+    if err != nil {
+        panic(err)
+    } else if !bytes.Equal(inner, buf[1:6]) || !bytes.Equal(dec.raw, buf[:6]) || !dec.recording {
+        panic(fmt.Sprintf("Nested capture mismatch! 0x%x 0x%x", inner, dec.raw))
+    }
+}
+
+// Test peeking the kind of the next value
+func TestPeekKind(t *testing.T) {
+    values := []interface{}{ nil, true, -3, 7, 300, -300, float32(1), 2.5, "abc", strings.Repeat("x", 40),
+                             []byte{ 1 }, []int{ 1 }, make([]int, 20), map[string]int{ "a": 1 } }
+    kinds := []Kind{ Nil, True, FixInt, FixUint, Uint16, Int16, Float32, Float64, FixStr, Str8,
+                     Bin8, FixArray, Array16, FixMap }
+    types := []Type{ NilType, BoolType, IntType, UintType, UintType, IntType, FloatType, FloatType, StringType, StringType,
+                     BinType, ArrayType, ArrayType, MapType }
+
+    buf := bytes.Buffer{}
+    enc := NewEncoder(&buf)
+    for _, v := range values {
+        if err := enc.Encode(v); err != nil {
+            panic(err)
+        }
+    }
+
+    //Peeking twice gives the same kind and consumes nothing
+    dec := NewDecoder(&buf)
+    for i := range values {
+        k, err := dec.PeekKind()
+        if err != nil {
+            panic(err)
+        } else if k2, _ := dec.PeekKind(); k != kinds[i] || k2 != k || k.Type() != types[i] {
+            panic(fmt.Sprintf("Peeked kind mismatch! %v (%v) != %v (%v)", k, k.Type(), kinds[i], types[i]))
+        }
+
+        if err := dec.Skip(); err != nil {
+            panic(err)
+        } else if dec.Kind() != k {
+            panic(fmt.Sprintf("Kind after skip mismatch! %v != %v", dec.Kind(), k))
+        }
+    }
+
+    if _, err := dec.PeekKind(); err != io.EOF {
+        panic(fmt.Sprintf("Expected io.EOF, got %v", err))
+    }
+}
+
+// Test reading a stream of concatenated values
+func TestStream(t *testing.T) {
+    buf := bytes.Buffer{}
+    enc := NewEncoder(&buf)
+    offsets := []int64{}
+    for i:=0; i<5; i++ {
+        offsets = append(offsets, int64(buf.Len()))
+        if err := enc.Encode(map[string]interface{}{ "seq": i, "msg": strings.Repeat("m", i*10) }); err != nil {
+            panic(err)
+        }
+    }
+
+    //Clean end of input between values
+    data := buf.Bytes()
+    dec := NewDecoder(bytes.NewReader(data))
+    n := 0
+    for dec.More() {
+        if dec.InputOffset() != offsets[n] {
+            panic(fmt.Sprintf("Offset mismatch! %v != %v", dec.InputOffset(), offsets[n]))
+        }
+
+        var v struct{ Seq int `msgpack:"seq"` }
+        if err := dec.Decode(&v); err != nil {
+            panic(err)
+        } else if v.Seq != n {
+            panic(fmt.Sprintf("Sequence mismatch! %v != %v", v.Seq, n))
+        }
+        n++
+    }
+
+    if n != 5 || dec.InputOffset() != int64(len(data)) {
+        panic(fmt.Sprintf("Read %d values ending at %d", n, dec.InputOffset()))
+    } else if _, err := dec.Token(); err != io.EOF {
+        panic(fmt.Sprintf("Expected io.EOF, got %v", err))
+    }
+
+    //Truncated last value
+    dec = NewDecoder(bytes.NewReader(data[:len(data)-3]))
+    var err error
+    for dec.More() {
+        var v interface{}
+        if err = dec.Decode(&v); err != nil {
+            break
+        }
+    }
+
+    if err != io.ErrUnexpectedEOF {
+        panic(fmt.Sprintf("Expected io.ErrUnexpectedEOF, got %v", err))
+    }
+}
+
+// Test decoding from readers that return short reads
+func TestShortReads(t *testing.T) {
+    type Msg struct {
+        Id uint64 `msgpack:"id"`
+        Name string `msgpack:"name"`
+        Data []byte `msgpack:"data"`
+        Vals []float64 `msgpack:"vals"`
+    }
+
+    msg := Msg{ 0x0033ffaabbcceeff, strings.Repeat("n", 300), bytes.Repeat([]byte{ 7 }, 10000), []float64{ 1.5, -2.25 } }
+    buf, err := Marshal(msg)
+    if err != nil {
+        panic(err)
+    }
+
+    readers := map[string]func(io.Reader) io.Reader{
+        "onebyte": iotest.OneByteReader,
+        "half": iotest.HalfReader,
+        "dataerr": iotest.DataErrReader,
+    }
+
+    for name, wrap := range readers {
+        var dmsg Msg
+        dec := NewDecoder(wrap(bytes.NewReader(append(append([]byte{}, buf...), buf...))))
+        for i:=0; i<2; i++ {
+            if err := dec.Decode(&dmsg); err != nil {
+                panic(fmt.Sprintf("%s: %v", name, err))
+            } else if !reflect.DeepEqual(msg, dmsg) {
+                panic(fmt.Sprintf("%s: decoded message mismatch", name))
+            }
+        }
+
+        if dec.More() {
+            panic(fmt.Sprintf("%s: expected end of input", name))
+        }
+    }
+
+    //Payloads cut short while bypassing the buffer return no data
+    big, _ := Marshal(bytes.Repeat([]byte{ 7 }, 3*decoderBufSize))
+    dec := NewDecoder(bytes.NewReader(big[:len(big)-10]))
+    if data, err := dec.ReadBytes(); err != io.ErrUnexpectedEOF || data != nil {
+        panic(fmt.Sprintf("Expected no data and io.ErrUnexpectedEOF, got %d bytes and %v", len(data), err))
+    }
+}
+
+// Function writes data into a pipe in small chunks
+func chunkedPipe(data []byte, n int, chunk int) net.Conn {
+    rd, wr := net.Pipe()
+    go func() {
+        for i:=0; i<n; i++ {
+            for b := data; len(b) > 0; {
+                c := min(chunk, len(b))
+                wr.Write(b[:c])
+                b = b[c:]
+            }
+        }
+        wr.Close()
+    }()
+
+    return rd
+}
+
+func benchmarkDecode(b *testing.B, rdr func([]byte) io.Reader) {
+    type Msg struct {
+        Id uint64 `msgpack:"id"`
+        Name string `msgpack:"name"`
+        Vals []int `msgpack:"vals"`
+    }
+
+    buf, err := Marshal(Msg{ 42, "benchmark", []int{ 1, 300, 70000, -5 } })
+    if err != nil {
+        panic(err)
+    }
+
+    b.SetBytes(int64(len(buf)))
+    b.ReportAllocs()
+    b.ResetTimer()
+    dec := NewDecoder(rdr(buf))
+    var msg Msg
+    for i:=0; i<b.N; i++ {
+        if err := dec.Decode(&msg); err != nil {
+            panic(err)
+        }
+    }
+}
+
+func BenchmarkDecodePipe(b *testing.B) {
+    benchmarkDecode(b, func(buf []byte) io.Reader { return chunkedPipe(buf, b.N, 7) })
+}
+
+func BenchmarkDecodeBytes(b *testing.B) {
+    benchmarkDecode(b, func(buf []byte) io.Reader { return bytes.NewReader(bytes.Repeat(buf, b.N)) })
+}
+
+// Test streaming values with the header writers
+func TestStreamingWriter(t *testing.T) {
+    buf := bytes.Buffer{}
+    enc := NewEncoder(&buf)
+
+    //Array element by element
+    enc.WriteArrayHeader(20)
+    for i:=0; i<20; i++ {
+        enc.Encode(i)
+    }
+
+    //Map pair by pair, str and bin data written directly
+    enc.WriteMapHeader(3)
+    enc.Encode("name")
+    enc.WriteStrHeader(40)
+    buf.WriteString(strings.Repeat("s", 40))
+    enc.Encode("data")
+    enc.WriteBinHeader(3)
+    buf.Write([]byte{ 1, 2, 3 })
+    enc.Encode("ext")
+    enc.WriteExtHeader(5, 4)
+    buf.Write([]byte{ 9, 9, 9, 9 })
+
+    //Same as encoding the values in one go
+    var ints []int
+    var m map[string]interface{}
+    dec := NewDecoder(&buf)
+    if err := dec.Decode(&ints); err != nil || len(ints) != 20 || ints[19] != 19 {
+        panic(fmt.Sprintf("Streamed array mismatch! %v %v", ints, err))
+    } else if err := dec.Decode(&m); err != nil {
+        panic(err)
+    }
+
+    expected := map[string]interface{}{ "name": strings.Repeat("s", 40), "data": []byte{ 1, 2, 3 }, "ext": Ext{ 5, []byte{ 9, 9, 9, 9 } } }
+    if !reflect.DeepEqual(m, expected) {
+        panic(fmt.Sprintf("Streamed map mismatch! %v", m))
+    }
+
+    //Ext headers pick the smallest format
+    for _, l := range []int{ 1, 2, 4, 8, 16, 3, 300, 70000 } {
+        b, err := Marshal(Ext{ -1, make([]byte, l) })
+        if err != nil {
+            panic(err)
+        }
+
+        var ext Ext
+        if err := Unmarshal(b, &ext); err != nil || len(ext.Data) != l || ext.Type != -1 {
+            panic(fmt.Sprintf("Ext of %d bytes mismatch! %v", l, err))
+        }
+    }
+
+    if err := enc.WriteArrayHeader(-1); err == nil {
+        panic("Expected error for negative length")
+    }
+}
+
+// Test the typed read API
+func TestTypedReads(t *testing.T) {
+    buf := bytes.Buffer{}
+    enc := NewEncoder(&buf)
+    enc.WriteMapHeader(2)
+    enc.Encode("ids")
+    enc.Encode([]interface{}{ -3, uint64(math.MaxUint64), int64(math.MinInt64), 70000 })
+    enc.Encode("ok")
+    enc.Encode(true)
+    enc.Encode(float32(0.5))
+    enc.Encode(2.25)
+    enc.Encode(nil)
+    enc.Encode([]byte{ 1, 2 })
+
+    dec := NewDecoder(&buf)
+    if n, err := dec.ReadMapHeader(); err != nil || n != 2 {
+        panic(fmt.Sprintf("ReadMapHeader mismatch! %v %v", n, err))
+    } else if s, err := dec.ReadString(); err != nil || s != "ids" {
+        panic(fmt.Sprintf("ReadString mismatch! %v %v", s, err))
+    } else if n, err := dec.ReadArrayHeader(); err != nil || n != 4 {
+        panic(fmt.Sprintf("ReadArrayHeader mismatch! %v %v", n, err))
+    } else if i, err := dec.ReadInt64(); err != nil || i != -3 {
+        panic(fmt.Sprintf("ReadInt64 mismatch! %v %v", i, err))
+    }
+
+    //Does not fit an int64
+    var terr *UnmarshalTypeError
+    if _, err := dec.ReadInt64(); !errors.As(err, &terr) {
+        panic(fmt.Sprintf("Expected overflow error, got %v", err))
+    } else if i, err := dec.ReadInt64(); err != nil || i != math.MinInt64 {
+        panic(fmt.Sprintf("ReadInt64 mismatch! %v %v", i, err))
+    } else if u, err := dec.ReadUint64(); err != nil || u != 70000 {
+        panic(fmt.Sprintf("ReadUint64 mismatch! %v %v", u, err))
+    }
+
+    //Type mismatch leaves the value in place
+    if _, err := dec.ReadBool(); !errors.As(err, &terr) || terr.Value != "str" {
+        panic(fmt.Sprintf("Expected type error, got %v", err))
+    }
+    t.Log(terr)
+
+    dec.Skip()
+    if b, err := dec.ReadBool(); err != nil || !b {
+        panic(fmt.Sprintf("ReadBool mismatch! %v %v", b, err))
+    } else if f, err := dec.ReadFloat64(); err != nil || f != 0.5 {
+        panic(fmt.Sprintf("ReadFloat64 mismatch! %v %v", f, err))
+    } else if f, err := dec.ReadFloat64(); err != nil || f != 2.25 {
+        panic(fmt.Sprintf("ReadFloat64 mismatch! %v %v", f, err))
+    } else if err := dec.ReadNil(); err != nil {
+        panic(err)
+    } else if b, err := dec.ReadBytes(); err != nil || !bytes.Equal(b, []byte{ 1, 2 }) {
+        panic(fmt.Sprintf("ReadBytes mismatch! %v %v", b, err))
+    } else if err := dec.ReadNil(); err != io.EOF {
+        panic(fmt.Sprintf("Expected io.EOF, got %v", err))
+    }
+}
+
+// Test dynamic values keep wire types and key order
+func TestValue(t *testing.T) {
+    raw := []byte{
+        0x83,
+        0xa4, 'n', 'a', 'm', 'e', 0xa3, 'b', 'o', 'b',
+        0xa5, 'i', 't', 'e', 'm', 's', 0x94, 0xd1, 0x01, 0x2c, 0xcc, 0x05, 0xca, 0x3f, 0xc0, 0x00, 0x00, 0xfd,
+        0xc4, 0x02, 0x01, 0x02, 0xd4, 0x07, 0x2a,
+    }
+
+    var v Value
+    if err := Unmarshal(raw, &v); err != nil {
+        panic(err)
+    } else if v.Type() != MapType || v.Len() != 3 {
+        panic(fmt.Sprintf("Value mismatch! %v", v))
+    } else if v.Items()[2].Key.Type() != BinType || v.Items()[2].Value.ExtType() != 7 {
+        panic(fmt.Sprintf("Value key order mismatch! %v", v))
+    }
+    t.Log(v)
+
+    items := v.Get("items")
+    if s := v.Get("name").String(); s != "bob" {
+        panic(fmt.Sprintf("Get mismatch! %v", s))
+    } else if i := items.Index(0); i.Kind() != Int16 || i.Int() != 300 {
+        panic(fmt.Sprintf("Index mismatch! %v %v", i.Kind(), i))
+    } else if u := items.Index(1); u.Type() != UintType || u.Uint() != 5 {
+        panic(fmt.Sprintf("Index mismatch! %v %v", u.Kind(), u))
+    } else if f := items.Index(2); f.Kind() != Float32 || f.Float() != 1.5 {
+        panic(fmt.Sprintf("Index mismatch! %v %v", f.Kind(), f))
+    } else if i := items.Index(3); i.Type() != IntType || i.Int() != -3 {
+        panic(fmt.Sprintf("Index mismatch! %v %v", i.Kind(), i))
+    } else if m := v.Get("missing").Index(2); m.IsValid() || m.Int() != 0 {
+        panic(fmt.Sprintf("Expected invalid value, got %v", m))
+    }
+
+    //Re-encoding gives the same bytes
+    if b, err := Marshal(v); err != nil {
+        panic(err)
+    } else if !bytes.Equal(b, raw) {
+        panic(fmt.Sprintf("Value round trip mismatch!\n% x\n% x", b, raw))
+    }
+
+    //Constructed values keep int and uint apart
+    built := NewMap(
+        MapItem{ NewString("a"), NewInt(5) },
+        MapItem{ NewString("b"), NewUint(5) },
+        MapItem{ NewString("c"), NewArray(NewNil(), NewBool(true), NewFloat64(-1)) },
+    )
+
+    var back Value
+    if b, err := Marshal(&built); err != nil {
+        panic(err)
+    } else if err := Unmarshal(b, &back); err != nil {
+        panic(err)
+    } else if back.Get("a").Type() != IntType || back.Get("b").Type() != UintType {
+        panic(fmt.Sprintf("Value type mismatch! %v", back))
+    } else if !reflect.DeepEqual(back.Get("c").Interface(), []interface{}{ nil, true, float64(-1) }) {
+        panic(fmt.Sprintf("Value array mismatch! %v", back.Get("c")))
+    }
+
+    //Values nest inside typed structs
+    type doc struct {
+        ID int `msgpack:"id"`
+        Meta Value `msgpack:"meta"`
+    }
+
+    var d doc
+    if b, err := Marshal(doc{ 1, built }); err != nil {
+        panic(err)
+    } else if err := Unmarshal(b, &d); err != nil {
+        panic(err)
+    } else if d.ID != 1 || d.Meta.Get("c").Len() != 3 {
+        panic(fmt.Sprintf("Nested Value mismatch! %+v", d))
+    }
+}
+
+// Test path queries on encoded bytes
+func TestGet(t *testing.T) {
+    b, _ := Marshal(map[string]interface{}{
+        "id": "r-1",
+        "items": []interface{}{ 1, map[string]interface{}{ "price": 2.5, "tags": []string{ "a", "b" } } },
+        "ok": true,
+        "big": uint64(math.MaxUint64),
+        "bin": []byte{ 9 },
+    })
+
+    if s, err := GetString(b, "id"); err != nil || s != "r-1" {
+        panic(fmt.Sprintf("GetString mismatch! %v %v", s, err))
+    } else if f, err := GetFloat(b, "items", 1, "price"); err != nil || f != 2.5 {
+        panic(fmt.Sprintf("GetFloat mismatch! %v %v", f, err))
+    } else if s, err := GetString(b, "items", uint8(1), "tags", 1); err != nil || s != "b" {
+        panic(fmt.Sprintf("GetString mismatch! %v %v", s, err))
+    } else if i, err := GetInt(b, "items", 0); err != nil || i != 1 {
+        panic(fmt.Sprintf("GetInt mismatch! %v %v", i, err))
+    } else if u, err := GetUint(b, "big"); err != nil || u != math.MaxUint64 {
+        panic(fmt.Sprintf("GetUint mismatch! %v %v", u, err))
+    } else if ok, err := GetBool(b, "ok"); err != nil || !ok {
+        panic(fmt.Sprintf("GetBool mismatch! %v %v", ok, err))
+    } else if bs, err := GetBytes(b, "bin"); err != nil || !bytes.Equal(bs, []byte{ 9 }) {
+        panic(fmt.Sprintf("GetBytes mismatch! %v %v", bs, err))
+    }
+
+    //Raw is the encoded sub value
+    raw, err := Get(b, "items", 1)
+    if err != nil {
+        panic(err)
+    } else if raw.Kind() != FixMap {
+        panic(fmt.Sprintf("Get kind mismatch! %v", raw.Kind()))
+    }
+
+    var m map[string]interface{}
+    if err := Unmarshal(raw, &m); err != nil || m["price"] != 2.5 {
+        panic(fmt.Sprintf("Get raw mismatch! %v %v", m, err))
+    }
+
+    //Integer map keys
+    ib, _ := Marshal(map[int]string{ -1: "neg", 300: "x" })
+    if s, err := GetString(ib, -1); err != nil || s != "neg" {
+        panic(fmt.Sprintf("GetString mismatch! %v %v", s, err))
+    }
+
+    //Missing paths and wrong types
+    var nerr *NotFoundError
+    var terr *UnmarshalTypeError
+    if _, err := Get(b, "items", 5); !errors.As(err, &nerr) || nerr.Path != "items[5]" {
+        panic(fmt.Sprintf("Expected not found error, got %v", err))
+    } else if _, err := Get(b, "id", "x"); !errors.As(err, &nerr) {
+        panic(fmt.Sprintf("Expected not found error, got %v", err))
+    } else if _, err := GetInt(b, "id"); !errors.As(err, &terr) {
+        panic(fmt.Sprintf("Expected type error, got %v", err))
+    } else if _, err := Get(b, 1.5); err == nil {
+        panic("Expected invalid path error")
+    } else if _, err := Get(b[:len(b)-1], "zzz"); err != io.ErrUnexpectedEOF {
+        panic(fmt.Sprintf("Expected io.ErrUnexpectedEOF, got %v", err))
+    }
+
+    //Documents ending where a value should start are truncated too
+    short := []byte{ 0x82, 0xa1, 'a', 0x01, 0xa1, 'b' }
+    for _, path := range [][]interface{}{ { "b" }, { "c" }, { 2 } } {
+        data := short
+        if _, isIdx := path[0].(int); isIdx {
+            data = []byte{ 0x93, 0x01 }
+        }
+
+        if _, err := Get(data, path...); err != io.ErrUnexpectedEOF {
+            panic(fmt.Sprintf("Expected io.ErrUnexpectedEOF for %v, got %v", path, err))
+        }
+    }
+
+    //Keys are read when they are not buffered yet
+    key, _ := Marshal("price")
+    for _, want := range []string{ "price", "prize", "pri" } {
+        dec := NewDecoder(iotest.OneByteReader(bytes.NewReader(key)))
+        if found, err := dec.matchKey(want, 0, false); err != nil || found != (want == "price") {
+            panic(fmt.Sprintf("Key match mismatch for %q! %v %v", want, found, err))
+        } else if dec.More() {
+            panic(fmt.Sprintf("Key %q was not consumed", want))
+        }
+    }
+}
+
+// Test editing encoded bytes in place
+func TestSetDelete(t *testing.T) {
+    b, _ := Marshal(map[string]interface{}{ "id": 1, "meta": map[string]interface{}{ "tags": []string{ "a" } } })
+
+    //Replace, add and append
+    b, err := Set(b, "abc-123", "meta", "trace")
+    if err != nil {
+        panic(err)
+    } else if b, err = Set(b, 2, "id"); err != nil {
+        panic(err)
+    } else if b, err = Set(b, "b", "meta", "tags", 1); err != nil {
+        panic(err)
+    }
+
+    var m map[string]interface{}
+    if err := Unmarshal(b, &m); err != nil {
+        panic(err)
+    }
+
+    want := map[string]interface{}{ "id": uint8(2), "meta": map[interface{}]interface{}{ "trace": "abc-123", "tags": []interface{}{ "a", "b" } } }
+    if !reflect.DeepEqual(m, want) {
+        panic(fmt.Sprintf("Set mismatch! %v", m))
+    }
+
+    //Missing parents and indices past the end are not created
+    var nerr *NotFoundError
+    if _, err := Set(b, 1, "nope", "x"); !errors.As(err, &nerr) {
+        panic(fmt.Sprintf("Expected not found error, got %v", err))
+    } else if _, err := Set(b, 1, "meta", "tags", 5); !errors.As(err, &nerr) {
+        panic(fmt.Sprintf("Expected not found error, got %v", err))
+    } else if _, err := Delete(b, "meta", "nope"); !errors.As(err, &nerr) {
+        panic(fmt.Sprintf("Expected not found error, got %v", err))
+    }
+
+    //Documents ending before the value are truncated
+    short := []byte{ 0x81, 0xa1, 'a' }
+    if _, err := Set(short, 1, "a"); err != io.ErrUnexpectedEOF {
+        panic(fmt.Sprintf("Expected io.ErrUnexpectedEOF, got %v", err))
+    } else if _, err := Delete(short, "a"); err != io.ErrUnexpectedEOF {
+        panic(fmt.Sprintf("Expected io.ErrUnexpectedEOF, got %v", err))
+    }
+
+    //A fixmap grows into a map16 and keeps that width when shrinking
+    buf := bytes.Buffer{}
+    enc := NewEncoder(&buf)
+    enc.WriteMapHeader(15)
+    for i:=0; i<15; i++ {
+        enc.Encode(i)
+        enc.Encode(i)
+    }
+    enc.Encode("after")
+
+    grown, err := Set(buf.Bytes(), true, 99)
+    if err != nil {
+        panic(err)
+    } else if Kind(grown[0]) != Map16 || grown[2] != 16 {
+        panic(fmt.Sprintf("Set header mismatch! % x", grown[:3]))
+    }
+
+    shrunk, err := Delete(grown, 3)
+    if err != nil {
+        panic(err)
+    } else if Kind(shrunk[0]) != Map16 || shrunk[2] != 15 {
+        panic(fmt.Sprintf("Delete header mismatch! % x", shrunk[:3]))
+    }
+
+    //Values after the document are untouched
+    dec := NewDecoder(bytes.NewReader(shrunk))
+    var im map[int]interface{}
+    var s string
+    if err := dec.Decode(&im); err != nil {
+        panic(err)
+    } else if _, ok := im[3]; ok || len(im) != 15 || im[99] != true {
+        panic(fmt.Sprintf("Delete mismatch! %v", im))
+    } else if err := dec.Decode(&s); err != nil || s != "after" {
+        panic(fmt.Sprintf("Trailing value mismatch! %v %v", s, err))
+    }
+}
+
+// Test converting msgpack to JSON
+func TestToJSON(t *testing.T) {
+    buf := bytes.Buffer{}
+    enc := NewEncoder(&buf)
+    enc.WriteMapHeader(5)
+    enc.Encode("s")
+    enc.Encode("a\"b\n\x01\xff")
+    enc.Encode("nums")
+    enc.Encode([]interface{}{ -3, uint64(math.MaxUint64), float32(1.5), 0.1 })
+    enc.Encode("bin")
+    enc.Encode([]byte{ 0xde, 0xad })
+    enc.Encode(7)
+    enc.Encode(Ext{ 5, []byte{ 1 } })
+    enc.Encode([]int{ 1, 2 })
+    enc.Encode(nil)
+    enc.Encode(true)
+    data := buf.Bytes()
+
+    out := bytes.Buffer{}
+    if err := ToJSON(&out, bytes.NewReader(data)); err != nil {
+        panic(err)
+    }
+
+    want := `{"s":"a\"b\n\u0001` + "�" + `","nums":[-3,18446744073709551615,1.5,0.1],"bin":"3q0=","7":{"$ext":5,"data":"AQ=="},"[1,2]":null}` + "\ntrue\n"
+    if out.String() != want {
+        panic(fmt.Sprintf("ToJSON mismatch!\n%s\n%s", out.String(), want))
+    }
+
+    //Options
+    out.Reset()
+    opts := JSONOptions{ Bin: BinHex, NonFinite: NonFiniteString }
+    if err := opts.ToJSON(&out, bytes.NewReader(append([]byte{ 0x92, 0xc4, 0x01, 0xab }, 0xcb, 0x7f, 0xf0, 0, 0, 0, 0, 0, 0))); err != nil {
+        panic(err)
+    } else if out.String() != "[\"ab\",\"+Inf\"]\n" {
+        panic(fmt.Sprintf("ToJSON options mismatch! %s", out.String()))
+    }
+
+    var verr *JSONValueError
+    if err := ToJSON(io.Discard, bytes.NewReader([]byte{ 0xcb, 0x7f, 0xf8, 0, 0, 0, 0, 0, 1 })); !errors.As(err, &verr) {
+        panic(fmt.Sprintf("Expected NaN error, got %v", err))
+    } else if err := (JSONOptions{ StrictKeys: true }).ToJSON(io.Discard, bytes.NewReader(data)); !errors.As(err, &verr) || verr.Offset != 48 {
+        panic(fmt.Sprintf("Expected key error, got %v", err))
+    } else if err := ToJSON(io.Discard, bytes.NewReader(data[:10])); err != io.ErrUnexpectedEOF {
+        panic(fmt.Sprintf("Expected io.ErrUnexpectedEOF, got %v", err))
+    }
+    t.Log(verr)
+
+    //Values before an error are still written
+    out.Reset()
+    if err := ToJSON(&out, bytes.NewReader([]byte{ 0x01, 0xc3, 0xc1 })); err == nil {
+        panic("Expected invalid control byte error")
+    } else if out.String() != "1\ntrue\n" {
+        panic(fmt.Sprintf("Expected output before the error, got %q", out.String()))
+    }
+}
+
+// Test converting JSON to msgpack
+func TestFromJSON(t *testing.T) {
+    src := `{"a": [1, -200, 300, 1.5, 18446744073709551615, 123456789012345678901234567890], "b": {"c": null, "d": [[], {}]}, "e": "x"} true`
+
+    out := bytes.Buffer{}
+    if err := FromJSON(&out, strings.NewReader(src)); err != nil {
+        panic(err)
+    }
+
+    dec := NewDecoder(&out)
+    var v Value
+    var b bool
+    if err := dec.Decode(&v); err != nil {
+        panic(err)
+    } else if err := dec.Decode(&b); err != nil || !b {
+        panic(fmt.Sprintf("Trailing value mismatch! %v %v", b, err))
+    }
+
+    kinds := []Kind{ FixUint, Int16, Uint16, Float64, Uint64, Float64 }
+    for i, k := range kinds {
+        if got := v.Get("a").Index(i).Kind(); got != k {
+            panic(fmt.Sprintf("FromJSON kind mismatch at %d! %v != %v", i, got, k))
+        }
+    }
+
+    if v.Get("b").Get("c").Type() != NilType || v.Get("b").Get("d").Index(1).Type() != MapType || v.Get("e").String() != "x" {
+        panic(fmt.Sprintf("FromJSON mismatch! %v", v))
+    }
+
+    //Large numbers kept as strings
+    out.Reset()
+    opts := JSONOptions{ LargeNumbersAsStrings: true }
+    if err := opts.FromJSON(&out, strings.NewReader(`[123456789012345678901234567890, 1e400]`)); err != nil {
+        panic(err)
+    } else if err := Unmarshal(out.Bytes(), &v); err != nil {
+        panic(err)
+    } else if v.Index(0).String() != "123456789012345678901234567890" || v.Index(1).String() != "1e400" {
+        panic(fmt.Sprintf("FromJSON large numbers mismatch! %v", v))
+    }
+
+    //Round trip through ToJSON
+    jout := bytes.Buffer{}
+    out.Reset()
+    if err := FromJSON(&out, strings.NewReader(`{"k":[1,-2,"s",{"n":null}]}`)); err != nil {
+        panic(err)
+    } else if err := ToJSON(&jout, &out); err != nil {
+        panic(err)
+    } else if jout.String() != "{\"k\":[1,-2,\"s\",{\"n\":null}]}\n" {
+        panic(fmt.Sprintf("JSON round trip mismatch! %s", jout.String()))
+    }
+
+    var lerr *LimitError
+    if err := FromJSON(io.Discard, strings.NewReader(`1e400`)); err == nil {
+        panic("Expected range error")
+    } else if err := FromJSON(io.Discard, strings.NewReader(`{"a": [`)); err == nil {
+        panic("Expected syntax error")
+    } else if err := (JSONOptions{ Limits: DecoderLimits{ MaxDepth: 2 } }).FromJSON(io.Discard, strings.NewReader(`[[[1]]]`)); !errors.As(err, &lerr) {
+        panic(fmt.Sprintf("Expected limit error, got %v", err))
+    }
+
+    //Values before an error are still written
+    mout := bytes.Buffer{}
+    if err := FromJSON(&mout, strings.NewReader(`1 true {`)); err == nil {
+        panic("Expected syntax error")
+    } else if !bytes.Equal(mout.Bytes(), []byte{ 0x01, 0xc3 }) {
+        panic(fmt.Sprintf("Expected output before the error, got %x", mout.Bytes()))
+    }
+}
+
+// Function returns annotated dumps of two encodings for failure messages
+func annotateMismatch(got []byte, want []byte) string {
+    sb := strings.Builder{}
+    sb.WriteString("got:\n")
+    Annotate(&sb, got)
+    sb.WriteString("want:\n")
+    Annotate(&sb, want)
+    return sb.String()
+}
+
+// Test the annotated hex dump
+func TestAnnotate(t *testing.T) {
+    b, _ := Marshal([]interface{}{ "name", 300, -3, float32(1.5), []byte{ 1, 2 }, Ext{ 5, []byte{ 9 } }, map[string]bool{ "ok": true } })
+
+    sb := strings.Builder{}
+    if err := Annotate(&sb, b); err != nil {
+        panic(err)
+    }
+    t.Log("\n" + sb.String())
+
+    want := []string{
+        "00000000  97                         0x97 fixarray len=7",
+        "00000001  a4 6e 61 6d 65               0xa4 fixstr len=4 \"name\"",
+        "00000006  cd 01 2c                     0xcd uint16 300",
+        "00000009  fd                           0xfd negative fixint -3",
+        "0000000a  ca 3f c0 00 00               0xca float32 1.5",
+        "0000000f  c4 02 01 02                  0xc4 bin8 len=2",
+        "00000013  d4 05 09                     0xd4 fixext1 type=5 len=1",
+        "00000016  81                           0x81 fixmap len=1",
+        "00000017  a2 6f 6b                       0xa2 fixstr len=2 \"ok\"",
+        "0000001a  c3                             0xc3 true",
+    }
+
+    if got := strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n"); !reflect.DeepEqual(got, want) {
+        panic(fmt.Sprintf("Annotate mismatch!\n%s", sb.String()))
+    }
+
+    //Malformed input marks the offending offset
+    for _, tc := range []struct{ data []byte; mark string }{
+        { []byte{ 0x92, 0x01, 0xc1 }, "00000002                               ^^ msgpack: invalid control byte 0xc1" },
+        { []byte{ 0x91, 0xd9, 0x2a, 'a' }, "00000004                               ^^ msgpack: str8 needs 42 payload bytes, 1 left" },
+        { []byte{ 0x93, 0x01 }, "00000002                               ^^ msgpack: 2 objects missing" },
+    }{
+        sb.Reset()
+        if err := Annotate(&sb, tc.data); err == nil {
+            panic("Expected Annotate error")
+        } else if !strings.Contains(sb.String(), tc.mark) {
+            panic(fmt.Sprintf("Annotate mark mismatch!\n%s", sb.String()))
+        }
+        t.Log("\n" + sb.String())
+    }
+}
+
+// Test structural diffs
+func TestDiff(t *testing.T) {
+    a := NewMap(
+        MapItem{ NewString("id"), NewInt(5) },
+        MapItem{ NewString("items"), NewArray(NewString("x"), NewFloat32(1.5), NewBin([]byte{ 1 })) },
+        MapItem{ NewString("gone"), NewNil() },
+        MapItem{ NewInt(-1), NewBool(true) },
+    )
+
+    b := NewMap(
+        MapItem{ NewString("items"), NewArray(NewString("x"), NewFloat64(1.5), NewString("\x01"), NewNil()) },
+        MapItem{ NewUint(5), NewString("new") },
+        MapItem{ NewString("id"), NewUint(5) },
+        MapItem{ NewInt(-1), NewBool(true) },
+    )
+
+    ab, _ := Marshal(a)
+    bb, _ := Marshal(b)
+    if diffs, err := Diff(ab, ab); err != nil || len(diffs) != 0 {
+        panic(fmt.Sprintf("Expected no differences, got %v %v", diffs, err))
+    }
+
+    diffs, err := Diff(ab, bb)
+    if err != nil {
+        panic(err)
+    }
+
+    got := []string{}
+    for _, d := range diffs {
+        got = append(got, d.String())
+    }
+
+    want := []string{
+        `~ items[2]: bin(01) -> "\x01"`,
+        "+ items[3]: <nil>",
+        "- gone: <nil>",
+        `+ [5]: "new"`,
+    }
+    if !reflect.DeepEqual(got, want) {
+        panic(fmt.Sprintf("Diff mismatch!\n%q\n%q", got, want))
+    }
+
+    //Strict compares formats and key order
+    got = got[:0]
+    diffs, _ = (DiffOptions{ Strict: true }).Diff(ab, bb)
+    for _, d := range diffs {
+        got = append(got, fmt.Sprintf("%v %s", d.Op, d.Path))
+    }
+
+    want = []string{ "changed id", "changed items[1]", "changed items[2]", "added items[3]", "removed gone", "added [5]" }
+    if !reflect.DeepEqual(got, want) {
+        panic(fmt.Sprintf("Strict diff mismatch!\n%q\n%q", got, want))
+    }
+
+    reordered := NewMap(a.Items()[1], a.Items()[0], a.Items()[2], a.Items()[3])
+    if diffs := (DiffOptions{}).DiffValues(a, reordered); len(diffs) != 0 {
+        panic(fmt.Sprintf("Expected no differences, got %v", diffs))
+    } else if diffs := (DiffOptions{ Strict: true }).DiffValues(a, reordered); len(diffs) != 1 || diffs[0].Path != "" {
+        panic(fmt.Sprintf("Expected key order difference, got %v", diffs))
+    }
+
+    //Malformed documents are an error, not equal
+    if _, err := Diff(ab, []byte{ 0xc1 }); err == nil {
+        panic("Expected decode error")
+    } else if _, err := Diff([]byte{ 0xc1 }, []byte{ 0xc1, 0xff }); err == nil {
+        panic("Expected decode error")
+    } else if _, err := Diff(ab, bb[:len(bb)-1]); err != io.ErrUnexpectedEOF {
+        panic(fmt.Sprintf("Expected io.ErrUnexpectedEOF, got %v", err))
+    }
+}
+
+// Test validating untrusted input
+func TestValidate(t *testing.T) {
+    good, _ := Marshal(map[string]interface{}{ "a": []interface{}{ 1, -300, 2.5, "s", []byte{ 1 }, Ext{ 1, []byte{ 1, 2, 3 } }, nil, true } })
+    if err := Validate(good); err != nil {
+        panic(err)
+    } else if allocs := testing.AllocsPerRun(100, func() { Valid(good) }); allocs != 0 {
+        panic(fmt.Sprintf("Valid allocated %v times", allocs))
+    }
+
+    for i, tc := range []struct{ data []byte; offset int64 }{
+        { []byte{}, 0 },
+        { []byte{ 0xc1 }, 0 },
+        { []byte{ 0x92, 0x01, 0xc1 }, 2 },
+        { []byte{ 0xd9 }, 1 },
+        { []byte{ 0xd9, 0x05, 'a' }, 0 },
+        { []byte{ 0xcd, 0x01 }, 0 },
+        { []byte{ 0xdd, 0xff, 0xff, 0xff, 0xff, 0x01 }, 0 },
+        { []byte{ 0x93, 0x01, 0x02 }, 0 },
+        { []byte{ 0x01, 0x02 }, 1 },
+        { good[:len(good)-1], int64(len(good)-1) },
+    }{
+        var serr *SyntaxError
+        if allocs := testing.AllocsPerRun(100, func() { Valid(tc.data) }); allocs != 0 {
+            panic(fmt.Sprintf("Valid allocated %v times rejecting case %d", allocs, i))
+        } else if Valid(tc.data) {
+            panic(fmt.Sprintf("Expected case %d to be invalid", i))
+        } else if err := Validate(tc.data); !errors.As(err, &serr) || serr.Offset != tc.offset {
+            panic(fmt.Sprintf("Validate mismatch for case %d! %v", i, err))
+        }
+    }
+
+    //UTF-8 is only checked when asked
+    bad := []byte{ 0xa2, 0xc3, 0x28 }
+    if err := Validate(bad); err != nil {
+        panic(err)
+    } else if err := (ValidateOptions{ UTF8: true }).Validate(bad); err == nil {
+        panic("Expected UTF-8 error")
+    }
+}
+
+// Test schema validation
+func TestSchema(t *testing.T) {
+    order := NewSchema(MapType).
+        Require("id", NewSchema(UintType)).
+        Require("items", NewSchema(ArrayType).Elem(NewSchema(MapType).Close().
+            Require("price", NewSchema(FloatType).Range(0, 100)).
+            Prop("sku", NewSchema(StringType)))).
+        Prop("state", NewSchema(StringType).OneOf("new", "paid")).
+        Prop("note", NewSchema(StringType).OrNil())
+
+    file := `{
+        "type": "object",
+        "required": ["id", "items"],
+        "properties": {
+            "id": {"type": "uint"},
+            "items": {"type": "array", "items": {
+                "type": "object", "additionalProperties": false, "required": ["price"],
+                "properties": {"price": {"type": "number", "minimum": 0, "maximum": 100}, "sku": {"type": "string"}}
+            }},
+            "state": {"type": "string", "enum": ["new", "paid"]},
+            "note": {"type": ["string", "null"]}
+        }
+    }`
+
+    loaded, err := LoadSchema(strings.NewReader(file))
+    if err != nil {
+        panic(err)
+    }
+
+    good, _ := Marshal(map[string]interface{}{ "id": 7, "items": []interface{}{ map[string]interface{}{ "price": 2.5, "sku": "a" }, map[string]int{ "price": 3 } }, "note": nil, "state": "paid", "extra": []int{ 1 } })
+    bad, _ := Marshal(map[string]interface{}{ "id": -1, "items": []interface{}{ map[string]interface{}{ "price": 250, "color": "red" }, map[string]interface{}{ "sku": 5 } }, "state": "lost" })
+    want := []string{ "id: expected uint, got int", "items[0].price: 250 is greater than 100", "items[0].color: unexpected key", "items[1].sku: expected str, got uint", "items[1]: missing key \"price\"", "state: lost is not one of [new paid]" }
+
+    for _, s := range []*Schema{ order, loaded } {
+        if err := s.Validate(good); err != nil {
+            panic(err)
+        }
+
+        var serrs SchemaErrors
+        if err := s.Validate(bad); !errors.As(err, &serrs) {
+            panic(fmt.Sprintf("Expected schema errors, got %v", err))
+        }
+
+        got := []string{}
+        for _, e := range serrs {
+            got = append(got, e.Path + ": " + e.Msg)
+        }
+
+        sort.Strings(got)
+        sort.Strings(want)
+        if !reflect.DeepEqual(got, want) {
+            panic(fmt.Sprintf("Schema errors mismatch!\n%q\n%q", got, want))
+        }
+        t.Log(serrs)
+    }
+
+    //Enums and ranges apply to scalars, not container lengths
+    arr, _ := Marshal([]int{ 1, 2, 3 })
+    obj, _ := Marshal(map[string]int{ "a": 1, "b": 2, "c": 3 })
+    for _, doc := range [][]byte{ arr, obj } {
+        if err := (&Schema{ Enum: []interface{}{ 3 } }).Validate(doc); err == nil {
+            panic(fmt.Sprintf("Expected enum error for %x", doc))
+        } else if err := NewSchema(InvalidType).Range(0, 2).Validate(doc); err != nil {
+            panic(fmt.Sprintf("Expected range to ignore %x, got %v", doc, err))
+        }
+    }
+
+    if err := NewSchema(ArrayType).Elem(NewSchema(IntType).Range(0, 2)).Validate(arr); err == nil || !strings.Contains(err.Error(), "[2]: 3 is greater than 2") {
+        panic(fmt.Sprintf("Expected element range error, got %v", err))
+    }
+
+    //ext and bin enums compare their bytes
+    kind := NewSchema(ExtType).OneOf(Ext{ 1, []byte{ 2 } })
+    bin := NewSchema(BinType).OneOf([]byte("ok"))
+    if doc, _ := Marshal(Ext{ 1, []byte{ 2 } }); kind.Validate(doc) != nil {
+        panic(fmt.Sprintf("Expected ext %x to match", doc))
+    } else if doc, _ := Marshal(Ext{ 1, []byte{ 3 } }); kind.Validate(doc) == nil {
+        panic(fmt.Sprintf("Expected enum error for ext %x", doc))
+    } else if doc, _ := Marshal([]byte("ok")); bin.Validate(doc) != nil {
+        panic(fmt.Sprintf("Expected bin %x to match", doc))
+    } else if doc, _ := Marshal([]byte("no")); bin.Validate(doc) == nil {
+        panic(fmt.Sprintf("Expected enum error for bin %x", doc))
+    }
+
+    //Documents are validated one by one from a stream
+    dec := NewDecoder(bytes.NewReader(append(append([]byte{}, good...), bad...)))
+    if err := order.ValidateNext(dec); err != nil {
+        panic(err)
+    } else if err := order.ValidateNext(dec); err == nil {
+        panic("Expected schema errors")
+    } else if err := order.ValidateNext(dec); err != io.EOF {
+        panic(fmt.Sprintf("Expected io.EOF, got %v", err))
+    }
+
+    if _, err := LoadSchema(strings.NewReader(`{"type": "decimal"}`)); err == nil {
+        panic("Expected unknown type error")
+    } else if err := order.Validate(good[:len(good)-1]); err != io.ErrUnexpectedEOF {
+        panic(fmt.Sprintf("Expected io.ErrUnexpectedEOF, got %v", err))
+    }
+}
+
+// Point encoded as a [x, y] array by hand written methods, the way
+// msgpackgen output would be
+type msgPoint struct {
+    X, Y int
+}
+
+func (p msgPoint) MarshalMsg(b []byte) ([]byte, error) {
+    b = AppendArrayHeader(b, 2)
+    b = AppendInt(b, int64(p.X))
+    return AppendInt(b, int64(p.Y)), nil
+}
+
+func (p *msgPoint) UnmarshalMsg(b []byte) ([]byte, error) {
+    n, b, err := ReadArrayHeaderBytes(b)
+    if err != nil {
+        return b, err
+    } else if n != 2 {
+        return b, fmt.Errorf("expected 2 coordinates, got %d", n)
+    }
+
+    x, b, err := ReadIntBytes(b, 0)
+    if err != nil {
+        return b, err
+    }
+
+    y, b, err := ReadIntBytes(b, 0)
+    p.X, p.Y = int(x), int(y)
+    return b, err
+}
+
+func (p msgPoint) Msgsize() int {
+    return HeaderSize + 2*IntSize
+}
+
+// Test generated method helpers and their use by Encode and Decode
+func TestMsgMethods(t *testing.T) {
+    type shape struct {
+        Name string `msgpack:"name"`
+        Points []msgPoint `msgpack:"points"`
+        Center *msgPoint `msgpack:"center"`
+    }
+
+    in := shape{ "tri", []msgPoint{ { 1, 2 }, { -3, 400 } }, &msgPoint{ 0, 1 } }
+    data, err := Marshal(in)
+    if err != nil {
+        panic(err)
+    }
+
+    want := []byte{ 0x83, 0xa4, 'n', 'a', 'm', 'e', 0xa3, 't', 'r', 'i', 0xa6, 'p', 'o', 'i', 'n', 't', 's', 0x92, 0x92, 0x01, 0x02, 0x92, 0xfd, 0xcd, 0x01, 0x90, 0xa6, 'c', 'e', 'n', 't', 'e', 'r', 0x92, 0x00, 0x01 }
+    if !bytes.Equal(data, want) {
+        panic(fmt.Sprintf("Generated encoding mismatch! %x", data))
+    }
+
+    //Decoded in place and from a stream
+    var out, streamed shape
+    if err := Unmarshal(data, &out); err != nil {
+        panic(err)
+    } else if err := NewDecoder(iotest.OneByteReader(bytes.NewReader(data))).Decode(&streamed); err != nil {
+        panic(err)
+    } else if !reflect.DeepEqual(in, out) || !reflect.DeepEqual(in, streamed) {
+        panic(fmt.Sprintf("Generated decoding mismatch! %+v %+v", out, streamed))
+    }
+
+    //Truncated input is unexpected, even at the top level
+    var p msgPoint
+    if err := Unmarshal(data[:len(data)-1], &out); err != io.ErrUnexpectedEOF {
+        panic(fmt.Sprintf("Expected io.ErrUnexpectedEOF, got %v", err))
+    } else if err := Unmarshal([]byte{ 0x92, 0x01 }, &p); err != io.ErrUnexpectedEOF {
+        panic(fmt.Sprintf("Expected io.ErrUnexpectedEOF, got %v", err))
+    }
+
+    //Options the generated code cannot honor fall back to reflection
+    var buf bytes.Buffer
+    enc := NewEncoder(&buf)
+    enc.SetTypeWidthInts(true)
+    if err := enc.Encode(msgPoint{ 1, 2 }); err != nil {
+        panic(err)
+    } else if buf.Bytes()[0] != 0x82 {
+        panic(fmt.Sprintf("Expected a map, got %x", buf.Bytes()))
+    }
+
+    //Append and read helpers round trip
+    b := AppendArrayHeader(nil, 7)
+    b = AppendString(b, strings.Repeat("s", 40))
+    b = AppendBytes(b, []byte{ 1 })
+    b = AppendInt(b, math.MinInt64)
+    b = AppendUint(b, 300)
+    b = AppendFloat32(b, 1.5)
+    b = AppendBool(b, true)
+    b = AppendNil(b)
+    if rest, err := SkipBytes(b); err != nil || len(rest) != 0 {
+        panic(fmt.Sprintf("Skip mismatch! %v %x", err, rest))
+    }
+
+    n, b, _ := ReadArrayHeaderBytes(b)
+    s, b, _ := ReadStringBytes(b)
+    bin, b, _ := ReadBytesBytes(b)
+    i, b, _ := ReadIntBytes(b, 64)
+    if _, _, err := ReadUintBytes(b, 8); err == nil {
+        panic("Expected uint8 overflow")
+    }
+
+    u, b, _ := ReadUintBytes(b, 16)
+    f, b, _ := ReadFloat64Bytes(b)
+    v, b, _ := ReadBoolBytes(b)
+    if n != 7 || len(s) != 40 || !bytes.Equal(bin, []byte{ 1 }) || i != math.MinInt64 || u != 300 || f != 1.5 || !v || !IsNil(b) {
+        panic(fmt.Sprintf("Read mismatch! %d %q %x %d %d %v %v %x", n, s, bin, i, u, f, v, b))
+    }
+
+    //nil bin is written the way Encode writes it
+    if enc, _ := Marshal([]byte(nil)); !bytes.Equal(AppendBytes(nil, nil), enc) {
+        panic(fmt.Sprintf("nil bin mismatch! %x != %x", AppendBytes(nil, nil), enc))
+    }
+
+    //Counts larger than the data are rejected before allocating
+    if _, _, err := ReadArrayHeaderBytes([]byte{ 0xdd, 0xff, 0xff, 0xff, 0xff, 0x01 }); err != io.ErrUnexpectedEOF {
+        panic(fmt.Sprintf("Expected io.ErrUnexpectedEOF, got %v", err))
+    }
+
+    //Struct keys follow the msgpack tags
+    typ := reflect.TypeOf(struct{ A int `msgpack:"a"`; B int `msgpack:",omitempty"`; C int; d int }{})
+    keys := []string{}
+    for j:=0; j<typ.NumField(); j++ {
+        if key, ok := StructFieldKey(typ.Field(j)); ok {
+            keys = append(keys, key)
+        }
+    }
+
+    if !reflect.DeepEqual(keys, []string{ "a", "C" }) {
+        panic(fmt.Sprintf("Field keys mismatch! %q", keys))
+    }
+}
+
+// Test the generic helpers
+func TestGeneric(t *testing.T) {
+    type line struct {
+        SKU string `msgpack:"sku"`
+        Qty int `msgpack:"qty"`
+        Note string `msgpack:",omitempty"`
+    }
+
+    type order struct {
+        ID uint64 `msgpack:"id"`
+        Lines []line `msgpack:"lines"`
+        Next *order `msgpack:"next"`
+    }
+
+    in := order{ 1, []line{ { "a", 2, "" } }, &order{ ID: 2, Lines: []line{} } }
+    data, err := MarshalT(in)
+    if err != nil {
+        panic(err)
+    }
+
+    out, err := UnmarshalT[order](data)
+    if err != nil {
+        panic(err)
+    } else if !reflect.DeepEqual(in, out) {
+        panic(fmt.Sprintf("UnmarshalT mismatch! %+v", out))
+    }
+
+    //Struct plans are cached, later calls allocate no more than the first
+    encAllocs := testing.AllocsPerRun(100, func() { Marshal(in) })
+    if encAllocs > 16 {
+        panic(fmt.Sprintf("Marshal allocated %v times", encAllocs))
+    }
+
+    decAllocs := testing.AllocsPerRun(100, func() { UnmarshalT[order](data) })
+    if decAllocs > 48 {
+        panic(fmt.Sprintf("UnmarshalT allocated %v times", decAllocs))
+    }
+
+    var lerr *LimitError
+    deep, _ := Marshal(order{ Next: &order{ Next: &order{ Next: &order{ Next: &order{} } } } })
+    if _, err := UnmarshalT[order](deep, DecoderLimits{ MaxDepth: 4 }); !errors.As(err, &lerr) {
+        panic(fmt.Sprintf("Expected a depth limit error, got %v", err))
+    }
+
+    //Streams decode one typed value at a time
+    dec := NewDecoder(bytes.NewReader(append(append([]byte{}, data...), data...)))
+    if first, err := DecodeNext[order](dec); err != nil || first.ID != 1 {
+        panic(fmt.Sprintf("DecodeNext mismatch! %+v %v", first, err))
+    } else if second, err := DecodeNext[order](dec); err != nil || !reflect.DeepEqual(in, second) {
+        panic(fmt.Sprintf("DecodeNext mismatch! %+v %v", second, err))
+    } else if _, err := DecodeNext[order](dec); err != io.EOF {
+        panic(fmt.Sprintf("Expected io.EOF, got %v", err))
+    }
+}
@@ -0,0 +1,353 @@
+package msgpack
+import (
+    "reflect"
+    "math"
+    "fmt"
+)
+
+// Raw is the encoded form of a single value returned by Get.
+// It shares memory with the data it was found in.
+type Raw = RawMessage
+
+// Error returned when a path does not lead to a value
+type NotFoundError struct {
+    Path string
+}
+
+func (e *NotFoundError) Error() string {
+    return "msgpack: no value at " + e.Path
+}
+
+// Function converts a path element into a map key or array index
+func pathElem(p interface{}) (key string, idx int64, isIdx bool, err error) {
+    rv := reflect.ValueOf(p)
+    switch rv.Kind() {
+        case reflect.String:
+            return rv.String(), 0, false, nil
+        case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+            return "", rv.Int(), true, nil
+        case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+            if u := rv.Uint(); int64(u) >= 0 {
+                return "", int64(u), true, nil
+            }
+    }
+
+    return "", 0, false, fmt.Errorf("msgpack: invalid path element %T(%v)", p, p)
+}
+
+// Method reads a map key and reports whether it equals the path
+// element. Keys of other types are skipped without being read.
+func (d *Decoder) matchKey(key string, idx int64, isIdx bool) (bool, error) {
+    cbyte, err := d.peekByte()
+    if err != nil {
+        return false, err
+    }
+
+    switch kindOf(cbyte).Type() {
+        case StringType, BinType:
+            if !isIdx {
+                _, l, err := d.readHeader()
+                if err != nil {
+                    return false, err
+                }
+
+                //Compare in place when the key is buffered, keys of
+                //another length never match
+                if d.w-d.r >= l || l != len(key) {
+                    match := d.w-d.r >= l && string(d.buf[d.r:d.r+l]) == key
+                    return match, d.skipBytes(l)
+                }
+
+                data, err := d.readData(l)
+                return err == nil && string(data) == key, err
+            }
+
+        case IntType, UintType:
+            if isIdx {
+                v, neg, err := d.readInteger(int64Type)
+                return err == nil && neg == (idx < 0) && v == uint64(idx), err
+            }
+    }
+
+    return false, d.discard()
+}
+
+// Position of a value inside the array or map enclosing it
+type location struct {
+    hdr int64      // Offset of the container header
+    hdrLen int
+    count int      // Elements or pairs of the container
+    isMap bool
+    entry int64    // Offset of the element, or of the key in a map
+    missing bool   // The last path element is not in the container
+}
+
+// Method walks from the next value along path, leaving the decoder
+// positioned at the value path leads to. Values before it are
+// skipped without being decoded. When only the last element is
+// missing the location is marked missing and its entry is the end
+// of the container.
+func (d *Decoder) find(path []interface{}) (loc location, err error) {
+    for i, p := range path {
+        key, idx, isIdx, err := pathElem(p)
+        if err != nil {
+            return loc, err
+        }
+
+        if isIdx {
+            d.push(fmt.Sprintf("[%d]", idx))
+        } else {
+            d.push("." + key)
+        }
+
+        cbyte, err := d.peekByte()
+        if err != nil {
+            return loc, err
+        }
+
+        //Only arrays and maps have anything to walk into
+        last := i == len(path)-1
+        found := false
+        loc = location{ hdr: d.off }
+        switch kindOf(cbyte).Type() {
+            case ArrayType:
+                n, err := d.ReadArrayHeader()
+                if err != nil {
+                    return loc, err
+                }
+
+                loc.hdrLen, loc.count = int(d.off-loc.hdr), n
+                skip := int64(0)
+                if isIdx && idx >= 0 && idx < int64(n) {
+                    skip, found = idx, true
+                } else if last {
+                    skip = int64(n)
+                }
+
+                for j:=int64(0); j<skip; j++ {
+                    if err := d.discard(); err != nil {
+                        return loc, err
+                    }
+                }
+
+                loc.entry = d.off
+
+            case MapType:
+                n, err := d.ReadMapHeader()
+                if err != nil {
+                    return loc, err
+                }
+
+                loc.isMap, loc.hdrLen, loc.count = true, int(d.off-loc.hdr), n
+                for j:=0; j<n && !found; j++ {
+                    loc.entry = d.off
+                    if found, err = d.matchKey(key, idx, isIdx); err != nil {
+                        return loc, err
+                    } else if !found {
+                        if err := d.discard(); err != nil {
+                            return loc, err
+                        }
+                    }
+                }
+
+                if !found {
+                    loc.entry = d.off
+                }
+
+            default:
+                return loc, &NotFoundError{ d.pathString() }
+        }
+
+        if !found {
+            loc.missing = last
+            return loc, &NotFoundError{ d.pathString() }
+        }
+    }
+
+    return loc, nil
+}
+
+// Function returns a decoder positioned at the value path leads to
+func query(data []byte, path []interface{}) (*Decoder, error) {
+    d := newBytesDecoder(data)
+    if _, err := d.find(path); err != nil {
+        return nil, err
+    }
+
+    return d, nil
+}
+
+// Function returns the encoded value at path without decoding the
+// rest of data. Path elements are map keys (strings, matching str
+// and bin keys) and array indices or integer map keys. An empty
+// path returns the first value of data.
+func Get(data []byte, path ...interface{}) (Raw, error) {
+    d, err := query(data, path)
+    if err != nil {
+        return nil, err
+    }
+
+    start := d.off
+    if err := d.discard(); err != nil {
+        return nil, err
+    }
+
+    return Raw(data[start:d.off:d.off]), nil
+}
+
+// Function returns the str at path
+func GetString(data []byte, path ...interface{}) (string, error) {
+    d, err := query(data, path)
+    if err != nil {
+        return "", err
+    }
+
+    return d.ReadString()
+}
+
+// Function returns the bin at path
+func GetBytes(data []byte, path ...interface{}) ([]byte, error) {
+    d, err := query(data, path)
+    if err != nil {
+        return nil, err
+    }
+
+    return d.ReadBytes()
+}
+
+// Function returns the integer at path
+func GetInt(data []byte, path ...interface{}) (int64, error) {
+    d, err := query(data, path)
+    if err != nil {
+        return 0, err
+    }
+
+    return d.ReadInt64()
+}
+
+// Function returns the unsigned integer at path
+func GetUint(data []byte, path ...interface{}) (uint64, error) {
+    d, err := query(data, path)
+    if err != nil {
+        return 0, err
+    }
+
+    return d.ReadUint64()
+}
+
+// Function returns the float at path as a float64
+func GetFloat(data []byte, path ...interface{}) (float64, error) {
+    d, err := query(data, path)
+    if err != nil {
+        return 0, err
+    }
+
+    return d.ReadFloat64()
+}
+
+// Function returns the bool at path
+func GetBool(data []byte, path ...interface{}) (bool, error) {
+    d, err := query(data, path)
+    if err != nil {
+        return false, err
+    }
+
+    return d.ReadBool()
+}
+
+// Function encodes an array or map header for n entries, keeping
+// the width of the hdrLen bytes header it replaces while n fits
+func resizeHeader(isMap bool, n int, hdrLen int) []byte {
+    fix, c16 := FixArray, Array16
+    if isMap {
+        fix, c16 = FixMap, Map16
+    }
+
+    switch {
+        case hdrLen == 1 && n <= 0x0f:
+            return []byte{ byte(fix) | byte(n) }
+        case hdrLen <= 3 && n <= math.MaxUint16:
+            return []byte{ byte(c16), byte(n >> 8), byte(n) }
+    }
+
+    return []byte{ byte(c16) + 1, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n) }
+}
+
+// Method returns a copy of data with the container holding n entries
+// and the bytes between from and to replaced by ins
+func (loc location) splice(data []byte, n int, from int64, to int64, ins []byte) []byte {
+    hdr := resizeHeader(loc.isMap, n, loc.hdrLen)
+    out := make([]byte, 0, len(data) + len(hdr) - loc.hdrLen + len(ins) - int(to-from))
+    out = append(out, data[:loc.hdr]...)
+    out = append(out, hdr...)
+    out = append(out, data[loc.hdr+int64(loc.hdrLen):from]...)
+    out = append(out, ins...)
+    return append(out, data[to:]...)
+}
+
+// Function returns a copy of data with the value at path replaced
+// by the encoding of value. A missing last map key is added to the
+// end of its map and an index one past the end of an array appends
+// to it, growing the container header if needed. Only the value and
+// the enclosing header change; the rest of data is copied as is.
+func Set(data []byte, value interface{}, path ...interface{}) ([]byte, error) {
+    enc, err := Marshal(value)
+    if err != nil {
+        return nil, err
+    }
+
+    d := newBytesDecoder(data)
+    loc, err := d.find(path)
+    if err == nil {
+        start := d.off
+        if err := d.discard(); err != nil {
+            return nil, err
+        }
+
+        out := make([]byte, 0, len(data) + len(enc) - int(d.off-start))
+        out = append(out, data[:start]...)
+        out = append(out, enc...)
+        return append(out, data[d.off:]...), nil
+    } else if !loc.missing {
+        return nil, err
+    }
+
+    //Add the missing entry
+    key, idx, isIdx, _ := pathElem(path[len(path)-1])
+    if loc.isMap {
+        var kenc []byte
+        if isIdx {
+            kenc, err = Marshal(idx)
+        } else {
+            kenc, err = Marshal(key)
+        }
+
+        if err != nil {
+            return nil, err
+        }
+
+        return loc.splice(data, loc.count+1, loc.entry, loc.entry, append(kenc, enc...)), nil
+    } else if isIdx && idx == int64(loc.count) {
+        return loc.splice(data, loc.count+1, loc.entry, loc.entry, enc), nil
+    }
+
+    return nil, err
+}
+
+// Function returns a copy of data without the map entry or array
+// element at path, decrementing the enclosing header's count
+func Delete(data []byte, path ...interface{}) ([]byte, error) {
+    if len(path) == 0 {
+        return nil, fmt.Errorf("msgpack: Delete requires a path")
+    }
+
+    d := newBytesDecoder(data)
+    loc, err := d.find(path)
+    if err != nil {
+        return nil, err
+    } else if err := d.discard(); err != nil {
+        return nil, err
+    }
+
+    return loc.splice(data, loc.count-1, loc.entry, d.off, nil), nil
+}
@@ -0,0 +1,457 @@
+package msgpack
+import (
+    "encoding/json"
+    "reflect"
+    "strings"
+    "bytes"
+    "fmt"
+    "io"
+)
+
+// Schema describes the expected shape of a document. Schemas are
+// built in Go, either as literals or with the chaining methods
+//
+//  order := NewSchema(MapType).
+//      Require("id", NewSchema(UintType)).
+//      Require("items", NewSchema(ArrayType).Elem(NewSchema(MapType).
+//          Require("price", NewSchema(FloatType).Range(0, 1e6)))).
+//      Prop("state", NewSchema(StringType).OneOf("new", "paid"))
+//
+// or loaded from a JSON schema file with LoadSchema.
+type Schema struct {
+    // Expected type, InvalidType accepts any. IntType accepts any
+    // integer, UintType non negative integers and FloatType any number.
+    Type Type
+    Nullable bool               // nil is accepted as well
+
+    Properties map[string]*Schema  // Schemas of map values by str key
+    Required []string              // Keys a map must have
+    Closed bool                    // Reject keys without a property
+
+    Items *Schema               // Schema of array elements
+    Enum []interface{}          // Values accepted, compared by value
+    Min, Max *float64           // Range of numbers
+}
+
+// Function returns a schema accepting values of type t
+func NewSchema(t Type) *Schema {
+    return &Schema{ Type: t }
+}
+
+// Method adds an optional map key
+func (s *Schema) Prop(key string, p *Schema) *Schema {
+    if s.Properties == nil {
+        s.Properties = make(map[string]*Schema)
+    }
+
+    s.Properties[key] = p
+    return s
+}
+
+// Method adds a map key that must be present
+func (s *Schema) Require(key string, p *Schema) *Schema {
+    s.Required = append(s.Required, key)
+    return s.Prop(key, p)
+}
+
+// Method rejects map keys that are not properties
+func (s *Schema) Close() *Schema {
+    s.Closed = true
+    return s
+}
+
+// Method sets the schema of array elements
+func (s *Schema) Elem(e *Schema) *Schema {
+    s.Items = e
+    return s
+}
+
+// Method restricts values to vals
+func (s *Schema) OneOf(vals ...interface{}) *Schema {
+    s.Enum = vals
+    return s
+}
+
+// Method restricts numbers to [min, max]
+func (s *Schema) Range(min, max float64) *Schema {
+    s.Min, s.Max = &min, &max
+    return s
+}
+
+// Method accepts nil as well
+func (s *Schema) OrNil() *Schema {
+    s.Nullable = true
+    return s
+}
+
+/************************/
+/** Start Schema Files **/
+/************************/
+
+// JSON form of a schema
+type schemaFile struct {
+    Type json.RawMessage `json:"type"`
+    Nullable bool `json:"nullable"`
+    Properties map[string]*schemaFile `json:"properties"`
+    Required []string `json:"required"`
+    AdditionalProperties *bool `json:"additionalProperties"`
+    Items *schemaFile `json:"items"`
+    Enum []interface{} `json:"enum"`
+    Minimum *float64 `json:"minimum"`
+    Maximum *float64 `json:"maximum"`
+}
+
+// Type names accepted in schema files, msgpack's and JSON schema's
+var schemaTypes = map[string]Type{
+    "nil": NilType, "null": NilType,
+    "bool": BoolType, "boolean": BoolType,
+    "int": IntType, "integer": IntType,
+    "uint": UintType,
+    "float": FloatType, "number": FloatType,
+    "str": StringType, "string": StringType,
+    "bin": BinType,
+    "array": ArrayType,
+    "map": MapType, "object": MapType,
+    "ext": ExtType,
+}
+
+// Function loads a schema from a JSON schema like document with the
+// keywords type, nullable, properties, required, additionalProperties,
+// items, enum, minimum and maximum. Types are msgpack type names or
+// their JSON schema equivalents, and ["type", "null"] is nullable.
+// Other keywords are ignored.
+func LoadSchema(r io.Reader) (*Schema, error) {
+    var f schemaFile
+    if err := json.NewDecoder(r).Decode(&f); err != nil {
+        return nil, fmt.Errorf("msgpack: schema: %w", err)
+    }
+
+    return f.schema("")
+}
+
+// Method converts the JSON form of a schema at path
+func (f *schemaFile) schema(path string) (*Schema, error) {
+    s := &Schema{ Nullable: f.Nullable, Required: f.Required, Enum: f.Enum, Min: f.Minimum, Max: f.Maximum }
+    s.Closed = f.AdditionalProperties != nil && !*f.AdditionalProperties
+
+    //Type is a name or a list of a name and null
+    var names []string
+    if len(f.Type) > 0 {
+        var name string
+        if err := json.Unmarshal(f.Type, &name); err == nil {
+            names = []string{ name }
+        } else if err := json.Unmarshal(f.Type, &names); err != nil {
+            return nil, fmt.Errorf("msgpack: schema: invalid type at %s", schemaPath(path))
+        }
+    }
+
+    for _, name := range names {
+        t, ok := schemaTypes[name]
+        switch {
+            case !ok:
+                return nil, fmt.Errorf("msgpack: schema: unknown type %q at %s", name, schemaPath(path))
+            case t == NilType && len(names) > 1:
+                s.Nullable = true
+            case s.Type != InvalidType:
+                return nil, fmt.Errorf("msgpack: schema: more than one type at %s", schemaPath(path))
+            default:
+                s.Type = t
+        }
+    }
+
+    for key, pf := range f.Properties {
+        p, err := pf.schema(path + "." + key)
+        if err != nil {
+            return nil, err
+        }
+
+        s.Prop(key, p)
+    }
+
+    if f.Items != nil {
+        items, err := f.Items.schema(path + "[]")
+        if err != nil {
+            return nil, err
+        }
+
+        s.Items = items
+    }
+
+    return s, nil
+}
+
+/**********************/
+/** End Schema Files **/
+/**********************/
+
+// Function returns a path for messages, <root> for the document
+func schemaPath(path string) string {
+    if path = strings.TrimPrefix(path, "."); path == "" {
+        return "<root>"
+    }
+
+    return path
+}
+
+// A value that does not match its schema
+type SchemaError struct {
+    Path string     // e.g. items[3].price, empty for the document
+    Msg string
+    Offset int64
+}
+
+func (e *SchemaError) Error() string {
+    return fmt.Sprintf("msgpack: %s: %s (offset %d)", schemaPath(e.Path), e.Msg, e.Offset)
+}
+
+// Every mismatch found in a document
+type SchemaErrors []*SchemaError
+
+func (e SchemaErrors) Error() string {
+    msgs := make([]string, len(e))
+    for i, err := range e {
+        msgs[i] = err.Error()
+    }
+
+    return strings.Join(msgs, "\n")
+}
+
+// Method checks that data holds one document matching the schema.
+// Returns SchemaErrors listing every mismatch, or the decoding error
+// of malformed data.
+func (s *Schema) Validate(data []byte) error {
+    d := newBytesDecoder(data)
+    if err := s.ValidateNext(d); err != nil {
+        return err
+    } else if d.More() {
+        return &SyntaxError{ "trailing data after object", d.off }
+    }
+
+    return nil
+}
+
+// Method checks the next value of d against the schema in a single
+// pass over its tokens, without decoding it into memory. The value
+// is consumed even when it does not match.
+func (s *Schema) ValidateNext(d *Decoder) error {
+    d.path = d.path[:0]
+    d.depth = 0
+    tok, err := d.Token()
+    if err != nil {
+        return err
+    }
+
+    var errs SchemaErrors
+    if err := s.check(d, tok, &errs); err != nil {
+        return err
+    } else if len(errs) > 0 {
+        return errs
+    }
+
+    return nil
+}
+
+// Method records a mismatch at the current token
+func schemaMismatch(d *Decoder, errs *SchemaErrors, format string, args ...interface{}) {
+    *errs = append(*errs, &SchemaError{ d.pathString(), fmt.Sprintf(format, args...), d.tokOff })
+}
+
+// Method skips the contents of a container whose start was read
+func skipContents(d *Decoder, tok Token) error {
+    n := 0
+    switch t := tok.(type) {
+        case ArrayStart:
+            n = int(t)
+        case MapStart:
+            n = 2 * int(t)
+    }
+
+    for i:=0; i<n; i++ {
+        if err := d.discard(); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// Function returns a number of any Go type as a float64
+func numberOf(v interface{}) (float64, bool) {
+    rv := reflect.ValueOf(v)
+    switch rv.Kind() {
+        case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+            return float64(rv.Int()), true
+        case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+            return float64(rv.Uint()), true
+        case reflect.Float32, reflect.Float64:
+            return rv.Float(), true
+    }
+
+    return 0, false
+}
+
+// Function reports whether a scalar token equals an enum value.
+// Numbers compare by value, bin equals str with the same bytes and
+// ext values compare their type and data.
+func enumMatch(tok Token, val interface{}) bool {
+    if a, ok := numberOf(tok); ok {
+        b, ok := numberOf(val)
+        return ok && a == b
+    } else if a, ok := tok.(Ext); ok {
+        b, ok := val.(Ext)
+        return ok && a.Type == b.Type && bytes.Equal(a.Data, b.Data)
+    }
+
+    if b, ok := tok.([]byte); ok {
+        tok = string(b)
+    }
+
+    if b, ok := val.([]byte); ok {
+        val = string(b)
+    }
+
+    return tok == val
+}
+
+// Method reports whether the type of the token read matches
+func (s *Schema) typeMatches(d *Decoder, tok Token) bool {
+    t := d.k.Type()
+    switch s.Type {
+        case InvalidType:
+            return true
+        case IntType:
+            return t == IntType || t == UintType
+        case UintType:
+            n, _ := numberOf(tok)
+            return t == UintType || (t == IntType && n >= 0)
+        case FloatType:
+            return t == FloatType || t == IntType || t == UintType
+    }
+
+    return t == s.Type
+}
+
+// Method checks the value starting with tok, appending mismatches
+// to errs. Returns decoding errors only.
+func (s *Schema) check(d *Decoder, tok Token, errs *SchemaErrors) error {
+    if s == nil || (tok == nil && s.Nullable) {
+        return skipContents(d, tok)
+    }
+
+    if !s.typeMatches(d, tok) {
+        schemaMismatch(d, errs, "expected %v, got %v", s.Type, d.k.Type())
+        return skipContents(d, tok)
+    }
+
+    //Enums hold scalars, so no container is one of them
+    switch t := tok.(type) {
+        case ArrayStart:
+            if len(s.Enum) > 0 {
+                schemaMismatch(d, errs, "array is not one of %v", s.Enum)
+            }
+
+            if err := d.enter(); err != nil {
+                return err
+            }
+            defer d.leave()
+
+            for i:=0; i<int(t); i++ {
+                d.push(fmt.Sprintf("[%d]", i))
+                tok, err := d.nextToken()
+                if err != nil {
+                    return err
+                } else if err := s.Items.check(d, tok, errs); err != nil {
+                    return err
+                }
+                d.pop()
+            }
+
+            return nil
+
+        case MapStart:
+            if len(s.Enum) > 0 {
+                schemaMismatch(d, errs, "map is not one of %v", s.Enum)
+            }
+
+            return s.checkMap(d, int(t), errs)
+    }
+
+    s.checkScalar(d, tok, errs)
+    return nil
+}
+
+// Method checks a scalar against the enum and range
+func (s *Schema) checkScalar(d *Decoder, tok Token, errs *SchemaErrors) {
+    if len(s.Enum) > 0 {
+        found := false
+        for _, val := range s.Enum {
+            found = found || enumMatch(tok, val)
+        }
+
+        if !found {
+            schemaMismatch(d, errs, "%v is not one of %v", tok, s.Enum)
+        }
+    }
+
+    if n, ok := numberOf(tok); ok {
+        if s.Min != nil && n < *s.Min {
+            schemaMismatch(d, errs, "%v is less than %v", tok, *s.Min)
+        } else if s.Max != nil && n > *s.Max {
+            schemaMismatch(d, errs, "%v is greater than %v", tok, *s.Max)
+        }
+    }
+}
+
+// Method checks the n pairs of a map
+func (s *Schema) checkMap(d *Decoder, n int, errs *SchemaErrors) error {
+    if err := d.enter(); err != nil {
+        return err
+    }
+    defer d.leave()
+
+    start := d.tokOff
+    seen := make(map[string]bool, len(s.Required))
+    for i:=0; i<n; i++ {
+        tok, err := d.nextToken()
+        if err != nil {
+            return err
+        }
+
+        //Keys are str, or bin holding the same bytes
+        key, ok := tok.(string)
+        if b, isBin := tok.([]byte); isBin {
+            key, ok = string(b), true
+        }
+
+        var p *Schema
+        if ok {
+            d.push("." + key)
+            p = s.Properties[key]
+            seen[key] = true
+        } else {
+            d.push(fmt.Sprintf("[%v]", tok))
+            if err := skipContents(d, tok); err != nil {
+                return err
+            }
+        }
+
+        if p == nil && s.Closed {
+            schemaMismatch(d, errs, "unexpected key")
+        }
+
+        if tok, err = d.nextToken(); err != nil {
+            return err
+        } else if err := p.check(d, tok, errs); err != nil {
+            return err
+        }
+        d.pop()
+    }
+
+    for _, key := range s.Required {
+        if !seen[key] {
+            *errs = append(*errs, &SchemaError{ d.pathString(), fmt.Sprintf("missing key %q", key), start })
+        }
+    }
+
+    return nil
+}
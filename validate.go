@@ -0,0 +1,167 @@
+package msgpack
+import (
+    "unicode/utf8"
+    "fmt"
+)
+
+// Options for validating encoded data
+type ValidateOptions struct {
+    UTF8 bool   // Reject str payloads that are not valid UTF-8
+}
+
+// Function reports whether data holds exactly one well-formed object,
+// without allocating whatever data holds
+func Valid(data []byte) bool {
+    problem, _, _, _ := ValidateOptions{}.check(data)
+    return problem == validOK
+}
+
+// Function checks that data holds exactly one well-formed object,
+// returning a *SyntaxError at the first problem
+func Validate(data []byte) error {
+    return ValidateOptions{}.Validate(data)
+}
+
+// Function reads a big endian length of n bytes at off
+func lengthAt(data []byte, off int, n int) int {
+    l := 0
+    for _, b := range data[off:off+n] {
+        l = l << 8 | int(b)
+    }
+
+    return l
+}
+
+// Problems found in data, turned into errors by Validate only
+type validateProblem int
+
+const (
+    validOK validateProblem = iota
+    validEOF            // Data ends before an object
+    validControl        // Reserved control byte
+    validHeader         // Data ends inside a header
+    validLength         // Payload runs past the end of data
+    validUTF8           // Invalid UTF-8 in a str
+    validCount          // More objects than bytes left
+    validTrailing       // Data after the object
+)
+
+// Method checks that data holds exactly one well-formed object:
+// no reserved control bytes, no lengths or counts running past the
+// end of data and nothing after the object. Returns a *SyntaxError
+// at the first problem. Valid data is checked without allocating.
+func (o ValidateOptions) Validate(data []byte) error {
+    problem, off, k, l := o.check(data)
+    switch problem {
+        case validEOF:
+            return &SyntaxError{ "unexpected end of data", int64(off) }
+        case validControl:
+            return &SyntaxError{ fmt.Sprintf("invalid control byte 0x%02x", data[off]), int64(off) }
+        case validHeader:
+            return &SyntaxError{ "unexpected end of data in " + formatName(k) + " header", int64(off) }
+        case validLength:
+            return &SyntaxError{ fmt.Sprintf("%s length %d overruns data", formatName(k), l), int64(off) }
+        case validUTF8:
+            return &SyntaxError{ "invalid UTF-8 in str", int64(off) }
+        case validCount:
+            return &SyntaxError{ fmt.Sprintf("%s count overruns data", formatName(k)), int64(off) }
+        case validTrailing:
+            return &SyntaxError{ "trailing data after object", int64(off) }
+    }
+
+    return nil
+}
+
+// Method walks the objects of data without allocating and returns
+// the first problem, its offset, and the kind and length of the
+// object it is in
+func (o ValidateOptions) check(data []byte) (problem validateProblem, off int, k Kind, l int) {
+    for remaining := 1; remaining > 0; remaining-- {
+        if off >= len(data) {
+            return validEOF, off, 0, 0
+        }
+
+        //Header size, length bytes, payload and nested objects
+        start := off
+        cbyte := data[off]
+        k = kindOf(cbyte)
+        hdr, lenBytes, children := 1, 0, 0
+        l = 0
+        switch {
+            case k == Nil || k == False || k == True || k == FixInt || k == FixUint:
+            case k == Uint8 || k == Int8:
+                l = 1
+            case k == Uint16 || k == Int16:
+                l = 2
+            case k == Uint32 || k == Int32 || k == Float32:
+                l = 4
+            case k == Uint64 || k == Int64 || k == Float64:
+                l = 8
+
+            case k == FixStr:
+                l = int(cbyte & 0x1f)
+            case k >= Str8 && k <= Str32:
+                lenBytes = 1 << (cbyte - byte(Str8))
+            case k >= Bin8 && k <= Bin32:
+                lenBytes = 1 << (cbyte - byte(Bin8))
+            case k >= FixExt1 && k <= FixExt16:
+                l = 1 + 1 << (cbyte - byte(FixExt1))
+            case k >= Ext8 && k <= Ext32:
+                lenBytes = 1 << (cbyte - byte(Ext8))
+
+            case k == FixArray:
+                children = int(cbyte & 0x0f)
+            case k == FixMap:
+                children = 2 * int(cbyte & 0x0f)
+            case k == Array16 || k == Array32:
+                lenBytes = 2 << (cbyte - byte(Array16))
+            case k == Map16 || k == Map32:
+                lenBytes = 2 << (cbyte - byte(Map16))
+
+            default:
+                return validControl, off, k, 0
+        }
+
+        //Read the length that follows the control byte
+        if lenBytes > 0 {
+            if len(data)-off-1 < lenBytes {
+                return validHeader, len(data), k, 0
+            }
+
+            n := lengthAt(data, off+1, lenBytes)
+            hdr += lenBytes
+            switch k.Type() {
+                case ArrayType:
+                    children = n
+                case MapType:
+                    children = 2 * n
+                case ExtType:
+                    l = n + 1
+                default:
+                    l = n
+            }
+        }
+
+        off += hdr
+        if l > len(data)-off {
+            return validLength, start, k, l
+        }
+
+        if o.UTF8 && k.Type() == StringType && !utf8.Valid(data[off:off+l]) {
+            return validUTF8, start, k, l
+        }
+
+        //Every outstanding object needs at least a byte
+        off += l
+        remaining += children
+        if children > 0 && remaining-1 > len(data)-off {
+            return validCount, start, k, l
+        }
+    }
+
+    if off != len(data) {
+        return validTrailing, off, 0, 0
+    }
+
+    return validOK, off, 0, 0
+}
@@ -0,0 +1,542 @@
+package msgpack
+import (
+    "reflect"
+    "strings"
+    "math"
+    "fmt"
+    "io"
+)
+
+// Value holds any msgpack object. Unlike decoding into interface{}
+// it keeps the exact wire type of numbers (int or uint and their
+// width, float32 or float64), str and bin apart, ext data and the
+// order of map keys, so decoding and re-encoding a Value gives the
+// same object back.
+type Value struct {
+    t Type
+    k Kind
+    i int64
+    u uint64
+    f float64
+    s string
+    b []byte
+    ext int8
+    arr []Value
+    items []MapItem
+}
+
+// MapItem is one key/value pair of a map Value
+type MapItem struct {
+    Key Value
+    Value Value
+}
+
+var valueType = reflect.TypeOf(Value{})
+
+/**************************/
+/** Start Constructors   **/
+/**************************/
+
+// Function returns a nil Value
+func NewNil() Value {
+    return Value{ t: NilType, k: Nil }
+}
+
+// Function returns a bool Value
+func NewBool(b bool) Value {
+    if b {
+        return Value{ t: BoolType, k: True }
+    }
+
+    return Value{ t: BoolType, k: False }
+}
+
+// Function returns an int Value using the smallest signed format
+func NewInt(v int64) Value {
+    k := Int64
+    switch {
+        case v < 0 && v >= -32:
+            k = FixInt
+        case v >= math.MinInt8 && v <= math.MaxInt8:
+            k = Int8
+        case v >= math.MinInt16 && v <= math.MaxInt16:
+            k = Int16
+        case v >= math.MinInt32 && v <= math.MaxInt32:
+            k = Int32
+    }
+
+    return Value{ t: IntType, k: k, i: v }
+}
+
+// Function returns a uint Value using the smallest unsigned format
+func NewUint(v uint64) Value {
+    k := Uint64
+    switch {
+        case v <= 0x7f:
+            k = FixUint
+        case v <= math.MaxUint8:
+            k = Uint8
+        case v <= math.MaxUint16:
+            k = Uint16
+        case v <= math.MaxUint32:
+            k = Uint32
+    }
+
+    return Value{ t: UintType, k: k, u: v }
+}
+
+// Function returns a float32 Value
+func NewFloat32(f float32) Value {
+    return Value{ t: FloatType, k: Float32, f: float64(f) }
+}
+
+// Function returns a float64 Value
+func NewFloat64(f float64) Value {
+    return Value{ t: FloatType, k: Float64, f: f }
+}
+
+// Function returns a str Value
+func NewString(s string) Value {
+    return Value{ t: StringType, k: FixStr, s: s }
+}
+
+// Function returns a bin Value
+func NewBin(b []byte) Value {
+    return Value{ t: BinType, k: Bin8, b: b }
+}
+
+// Function returns an ext Value
+func NewExt(typ int8, data []byte) Value {
+    return Value{ t: ExtType, k: Ext8, ext: typ, b: data }
+}
+
+// Function returns an array Value
+func NewArray(vals ...Value) Value {
+    return Value{ t: ArrayType, k: FixArray, arr: vals }
+}
+
+// Function returns a map Value keeping the order of items
+func NewMap(items ...MapItem) Value {
+    return Value{ t: MapType, k: FixMap, items: items }
+}
+
+/************************/
+/** End Constructors   **/
+/************************/
+
+/**************************/
+/** Start Accessors      **/
+/**************************/
+
+// Method returns the format family, InvalidType for the zero Value
+func (v Value) Type() Type {
+    return v.t
+}
+
+// Method returns the kind the Value was decoded from or will
+// be encoded as
+func (v Value) Kind() Kind {
+    return v.k
+}
+
+// Method reports whether the Value holds an object. Lookups that
+// fail return the zero Value, which is not valid.
+func (v Value) IsValid() bool {
+    return v.t != InvalidType
+}
+
+// Method reports whether the Value is nil
+func (v Value) IsNil() bool {
+    return v.t == NilType
+}
+
+// Method returns the bool, false for other types
+func (v Value) Bool() bool {
+    return v.k == True
+}
+
+// Method returns an int or uint as int64, 0 for other types
+func (v Value) Int() int64 {
+    switch v.t {
+        case IntType:
+            return v.i
+        case UintType:
+            return int64(v.u)
+    }
+
+    return 0
+}
+
+// Method returns an int or uint as uint64, 0 for other types
+func (v Value) Uint() uint64 {
+    switch v.t {
+        case IntType:
+            return uint64(v.i)
+        case UintType:
+            return v.u
+    }
+
+    return 0
+}
+
+// Method returns a float, int or uint as float64, 0 for other types
+func (v Value) Float() float64 {
+    switch v.t {
+        case FloatType:
+            return v.f
+        case IntType:
+            return float64(v.i)
+        case UintType:
+            return float64(v.u)
+    }
+
+    return 0
+}
+
+// Method returns the contents of a str. Other types are
+// formatted for printing.
+func (v Value) String() string {
+    if v.t == StringType {
+        return v.s
+    }
+
+    sb := strings.Builder{}
+    v.format(&sb)
+    return sb.String()
+}
+
+// Method returns the data of a bin or ext, nil for other types
+func (v Value) Bytes() []byte {
+    return v.b
+}
+
+// Method returns the application type of an ext
+func (v Value) ExtType() int8 {
+    return v.ext
+}
+
+// Method returns the number of array elements, map pairs or
+// str and bin bytes
+func (v Value) Len() int {
+    switch v.t {
+        case ArrayType:
+            return len(v.arr)
+        case MapType:
+            return len(v.items)
+        case StringType:
+            return len(v.s)
+        case BinType, ExtType:
+            return len(v.b)
+    }
+
+    return 0
+}
+
+// Method returns the i'th array element, or the zero Value when
+// v is not an array or i is out of range
+func (v Value) Index(i int) Value {
+    if v.t != ArrayType || i < 0 || i >= len(v.arr) {
+        return Value{}
+    }
+
+    return v.arr[i]
+}
+
+// Method returns the value of the first str or bin key equal to
+// key, or the zero Value when v is not a map or has no such key
+func (v Value) Get(key string) Value {
+    for _, item := range v.items {
+        switch item.Key.t {
+            case StringType:
+                if item.Key.s == key {
+                    return item.Value
+                }
+
+            case BinType:
+                if string(item.Key.b) == key {
+                    return item.Value
+                }
+        }
+    }
+
+    return Value{}
+}
+
+// Method returns the elements of an array
+func (v Value) Array() []Value {
+    return v.arr
+}
+
+// Method returns the pairs of a map in their original order
+func (v Value) Items() []MapItem {
+    return v.items
+}
+
+// Method returns the value as the Go type Decode would use for
+// an interface{}
+func (v Value) Interface() interface{} {
+    switch v.t {
+        case BoolType:
+            return v.Bool()
+        case IntType:
+            return v.i
+        case UintType:
+            return v.u
+        case FloatType:
+            if v.k == Float32 {
+                return float32(v.f)
+            }
+
+            return v.f
+        case StringType:
+            return v.s
+        case BinType:
+            return v.b
+        case ExtType:
+            return Ext{ v.ext, v.b }
+        case ArrayType:
+            arr := make([]interface{}, len(v.arr))
+            for i := range v.arr {
+                arr[i] = v.arr[i].Interface()
+            }
+
+            return arr
+        case MapType:
+            m := make(map[interface{}]interface{}, len(v.items))
+            for _, item := range v.items {
+                key := item.Key.Interface()
+                if b, ok := key.([]byte); ok {
+                    key = string(b)
+                }
+
+                if reflect.TypeOf(key).Comparable() {
+                    m[key] = item.Value.Interface()
+                }
+            }
+
+            return m
+    }
+
+    return nil
+}
+
+// Method writes a readable form of the value
+func (v Value) format(sb *strings.Builder) {
+    switch v.t {
+        case StringType:
+            fmt.Fprintf(sb, "%q", v.s)
+        case BinType:
+            fmt.Fprintf(sb, "bin(%x)", v.b)
+        case ExtType:
+            fmt.Fprintf(sb, "ext(%d, %x)", v.ext, v.b)
+        case ArrayType:
+            sb.WriteByte('[')
+            for i := range v.arr {
+                if i > 0 {
+                    sb.WriteString(", ")
+                }
+
+                v.arr[i].format(sb)
+            }
+            sb.WriteByte(']')
+        case MapType:
+            sb.WriteByte('{')
+            for i, item := range v.items {
+                if i > 0 {
+                    sb.WriteString(", ")
+                }
+
+                item.Key.format(sb)
+                sb.WriteString(": ")
+                item.Value.format(sb)
+            }
+            sb.WriteByte('}')
+        case InvalidType:
+            sb.WriteString("<invalid>")
+        default:
+            fmt.Fprint(sb, v.Interface())
+    }
+}
+
+/************************/
+/** End Accessors      **/
+/************************/
+
+// Function writes a control byte followed by size big endian bytes of bits
+func writeFixed(wtr io.Writer, ctl Kind, bits uint64, size int) error {
+    var buf [9]byte
+    buf[0] = byte(ctl)
+    for i:=size; i>0; i-- {
+        buf[i] = byte(bits)
+        bits >>= 8
+    }
+
+    _, err := wtr.Write(buf[:size+1])
+    return err
+}
+
+// Method encodes the value. Numbers are written in the exact
+// format of their kind unless canonical, everything else in
+// its smallest form.
+func (v Value) encode(e *Encoder) error {
+    //Canonical numbers use their smallest form
+    if e.canonical {
+        switch v.t {
+            case IntType, UintType, FloatType:
+                return e.Encode(v.Interface())
+        }
+    }
+
+    switch v.k {
+        case FixInt:
+            return writeByte(e.wtr, byte(v.i))
+        case Int8, Int16, Int32, Int64:
+            return writeFixed(e.wtr, v.k, uint64(v.i), 1 << (v.k - Int8))
+        case FixUint:
+            return writeByte(e.wtr, byte(v.u))
+        case Uint8, Uint16, Uint32, Uint64:
+            return writeFixed(e.wtr, v.k, v.u, 1 << (v.k - Uint8))
+        case Float32:
+            return writeFixed(e.wtr, v.k, uint64(math.Float32bits(float32(v.f))), 4)
+        case Float64:
+            return writeFixed(e.wtr, v.k, math.Float64bits(v.f), 8)
+    }
+
+    switch v.t {
+        case NilType:
+            return EncodeNil(e.wtr)
+        case BoolType:
+            return EncodeBool(e.wtr, v.Bool())
+        case StringType:
+            return EncodeString(e.wtr, v.s)
+        case BinType:
+            return EncodeBin(e.wtr, v.b)
+        case ExtType:
+            return EncodeExt(e.wtr, v.ext, v.b)
+
+        case ArrayType:
+            if err := e.writeArrayHeader(len(v.arr)); err != nil {
+                return err
+            }
+
+            for i := range v.arr {
+                if err := v.arr[i].encode(e); err != nil {
+                    return err
+                }
+            }
+
+            return nil
+
+        case MapType:
+            //Canonical maps are sorted like any other map
+            if e.canonical {
+                ks := make([]interface{}, len(v.items))
+                vs := make([]interface{}, len(v.items))
+                for i, item := range v.items {
+                    ks[i], vs[i] = item.Key, item.Value
+                }
+
+                return e.encodeSortedEntries(ks, vs)
+            }
+
+            if err := e.writeMapHeader(len(v.items)); err != nil {
+                return err
+            }
+
+            for _, item := range v.items {
+                if err := item.Key.encode(e); err != nil {
+                    return err
+                } else if err := item.Value.encode(e); err != nil {
+                    return err
+                }
+            }
+
+            return nil
+    }
+
+    return &UnsupportedValueError{ reflect.ValueOf(v), "invalid Value" }
+}
+
+// Method converts an already read token into a Value
+func (d *Decoder) tokenValue(tok Token) (Value, error) {
+    k := d.k
+    switch t := tok.(type) {
+        case nil:
+            return NewNil(), nil
+        case bool:
+            return NewBool(t), nil
+
+        case int8:
+            return Value{ t: IntType, k: k, i: int64(t) }, nil
+        case int16:
+            return Value{ t: IntType, k: k, i: int64(t) }, nil
+        case int32:
+            return Value{ t: IntType, k: k, i: int64(t) }, nil
+        case int64:
+            return Value{ t: IntType, k: k, i: t }, nil
+
+        case uint8:
+            return Value{ t: UintType, k: k, u: uint64(t) }, nil
+        case uint16:
+            return Value{ t: UintType, k: k, u: uint64(t) }, nil
+        case uint32:
+            return Value{ t: UintType, k: k, u: uint64(t) }, nil
+        case uint64:
+            return Value{ t: UintType, k: k, u: t }, nil
+
+        case float32:
+            return NewFloat32(t), nil
+        case float64:
+            return NewFloat64(t), nil
+        case string:
+            return Value{ t: StringType, k: k, s: t }, nil
+        case []byte:
+            return Value{ t: BinType, k: k, b: t }, nil
+        case Ext:
+            return Value{ t: ExtType, k: k, ext: t.Type, b: t.Data }, nil
+
+        case ArrayStart:
+            if err := d.enter(); err != nil {
+                return Value{}, err
+            }
+            defer d.leave()
+
+            arr := make([]Value, int(t))
+            for i := range arr {
+                tok, err := d.nextToken()
+                if err != nil {
+                    return Value{}, err
+                }
+
+                if arr[i], err = d.tokenValue(tok); err != nil {
+                    return Value{}, err
+                }
+            }
+
+            return Value{ t: ArrayType, k: k, arr: arr }, nil
+
+        case MapStart:
+            if err := d.enter(); err != nil {
+                return Value{}, err
+            }
+            defer d.leave()
+
+            items := make([]MapItem, int(t))
+            for i := range items {
+                for _, dst := range []*Value{ &items[i].Key, &items[i].Value } {
+                    tok, err := d.nextToken()
+                    if err != nil {
+                        return Value{}, err
+                    }
+
+                    if *dst, err = d.tokenValue(tok); err != nil {
+                        return Value{}, err
+                    }
+                }
+            }
+
+            return Value{ t: MapType, k: k, items: items }, nil
+    }
+
+    return Value{}, &SyntaxError{ fmt.Sprintf("unexpected token %T", tok), d.tokOff }
+}